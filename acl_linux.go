@@ -0,0 +1,30 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// aclSupported tells whether --has-acl and --no-acl are available on this platform
+const aclSupported = true
+
+// aclXattrs are extended attributes holding POSIX ACLs, present only on entries with ACLs beyond their mode bits
+var aclXattrs = []string{"system.posix_acl_access", "system.posix_acl_default"}
+
+// HasACL tells whether entry at path, not following symlinks, has POSIX access or default ACL
+func HasACL(path string) (bool, error) {
+	for _, name := range aclXattrs {
+		_, err := unix.Lgetxattr(path, name, nil)
+		if err == nil {
+			return true, nil
+		}
+		if err != unix.ENODATA && err != unix.EOPNOTSUPP {
+			return false, &os.PathError{Op: "getxattr", Path: path, Err: err}
+		}
+	}
+	return false, nil
+}
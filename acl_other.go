@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// aclSupported tells whether --has-acl and --no-acl are available on this platform
+const aclSupported = false
+
+// HasACL is not implemented outside of Linux, where ACLs are not exposed as POSIX ACL extended attributes
+func HasACL(path string) (bool, error) {
+	return false, &os.PathError{Op: "getxattr", Path: path, Err: errors.ErrUnsupported}
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// tooLargeError is returned by actions reading file content, for files exceeding --max-read-size
+var tooLargeError = errors.New("larger than --max-read-size")
+
+// hardLinkedError is returned by --shred for files with other names, which would be left with shredded content
+var hardLinkedError = errors.New("file has other hard links, their content would be shredded too")
+
+// action is applied to every found entry in results stage, outcome is reported as [<name>_success] or [<name>_failed]
+type action interface {
+	name() string
+	// describe tells what apply would do to result, for --dry-run
+	describe(e *Explorer, result Result) string
+	apply(e *Explorer, result Result) error
+}
+
+const (
+	actionSuccess = "success"
+	actionFailed  = "failed"
+	actionSkipped = "skipped"
+	actionDryRun  = "dry_run"
+)
+
+// applyAction runs a over result, logging and returning the outcome
+func (e *Explorer) applyAction(a action, result Result) string {
+	title := strings.ToUpper(a.name()[:1]) + a.name()[1:]
+	if e.dryRun {
+		logInfof("%s dry run: %s - %s", title, result.name, a.describe(e, result))
+		e.summary.add(a.name(), actionDryRun, result.name, nil)
+		return actionDryRun
+	}
+	err := a.apply(e, result)
+	outcome := actionSuccess
+	if errors.Is(err, tooLargeError) {
+		logInfof("%s skipped: %s - %v", title, result.name, err)
+		outcome = actionSkipped
+	} else if err != nil {
+		logErrorf("%s failed: %s - Error: %v", title, result.name, err)
+		outcome = actionFailed
+	} else {
+		logInfof("%s success: %s", title, result.name)
+	}
+	e.summary.add(a.name(), outcome, result.name, err)
+	return outcome
+}
+
+// deleteAction removes found entries, non empty directories are removed only when all is set.
+// With shredPasses regular files are overwritten with random data that many times before removal
+type deleteAction struct {
+	all         bool
+	shredPasses int
+}
+
+func (a *deleteAction) name() string {
+	return "delete"
+}
+
+func (a *deleteAction) describe(e *Explorer, result Result) string {
+	if a.all {
+		return "would be removed with all its contents"
+	}
+	if a.shredPasses > 0 && result.dtype == syscall.DT_REG {
+		return fmt.Sprintf("would be overwritten %d times and removed", a.shredPasses)
+	}
+	return "would be removed"
+}
+
+func (a *deleteAction) apply(e *Explorer, result Result) error {
+	if a.shredPasses > 0 && result.dtype == syscall.DT_REG {
+		if err := shredFile(result.name, a.shredPasses); err != nil {
+			return err
+		}
+	}
+	var err error
+	if result.dir != nil {
+		if err = unix.Unlinkat(int(result.dir.file.Fd()), filepath.Base(result.name), 0); err != nil {
+			err = &os.PathError{Op: "remove", Path: result.name, Err: err}
+		}
+	} else if a.all {
+		err = os.RemoveAll(result.name)
+	} else {
+		err = os.Remove(result.name)
+	}
+	if err == nil && e.pruneEmpty {
+		e.addEmptyCandidate(result.path())
+	}
+	return err
+}
+
+// shredFile overwrites content of file with random data passes times, syncing every pass to reach the disk.
+// It doesn't help on copy-on-write filesystems and SSDs, which write new data elsewhere.
+// Files with more than one hard link are refused, as only this name of them is removed
+func shredFile(path string, passes int) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|syscall.O_NOFOLLOW, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Sys().(*syscall.Stat_t).Nlink > 1 {
+		return hardLinkedError
+	}
+	buffer := make([]byte, 64*1024)
+	for pass := 0; pass < passes; pass++ {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		for remaining := info.Size(); remaining > 0; {
+			chunk := buffer[:min(remaining, int64(len(buffer)))]
+			if _, err := rand.Read(chunk); err != nil {
+				return err
+			}
+			written, err := file.Write(chunk)
+			if err != nil {
+				return err
+			}
+			remaining -= int64(written)
+		}
+		if err := file.Sync(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const (
+	collisionError     = "error"
+	collisionSuffix    = "suffix"
+	collisionOverwrite = "overwrite"
+)
+
+// moveAction relocates found entries into destination, preserving their path relative to the seed.
+// Directories are recreated rather than moved, so their content is still handled entry by entry
+type moveAction struct {
+	destination string
+	onCollision string
+}
+
+func (a *moveAction) name() string {
+	return "move"
+}
+
+func (a *moveAction) describe(e *Explorer, result Result) string {
+	return "would be moved to " + filepath.Join(a.destination, e.seedRelative(result.path()))
+}
+
+func (a *moveAction) apply(e *Explorer, result Result) error {
+	source := result.path()
+	target := filepath.Join(a.destination, e.seedRelative(source))
+	info, err := os.Lstat(source)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return os.MkdirAll(target, info.Mode().Perm())
+	}
+	if err = os.MkdirAll(filepath.Dir(target), 0777); err != nil {
+		return err
+	}
+	if target, err = resolveCollision(target, a.onCollision); err != nil {
+		return err
+	}
+	err = os.Rename(source, target)
+	if errors.Is(err, syscall.EXDEV) {
+		if e.isTooLargeToRead(info) {
+			return tooLargeError
+		}
+		if err = copyEntry(source, target, info); err == nil {
+			err = os.Remove(source)
+		}
+	}
+	if err == nil && e.pruneEmpty {
+		e.addEmptyCandidate(result.path())
+	}
+	return err
+}
+
+// copyAction copies found entries into destination, preserving their path relative to the seed,
+// permissions and modification time
+type copyAction struct {
+	destination string
+	onCollision string
+}
+
+func (a *copyAction) name() string {
+	return "copy"
+}
+
+func (a *copyAction) describe(e *Explorer, result Result) string {
+	return "would be copied to " + filepath.Join(a.destination, e.seedRelative(result.path()))
+}
+
+func (a *copyAction) apply(e *Explorer, result Result) error {
+	source := result.path()
+	target := filepath.Join(a.destination, e.seedRelative(source))
+	info, err := os.Lstat(source)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		if err = os.MkdirAll(target, info.Mode().Perm()); err != nil {
+			return err
+		}
+		return os.Chmod(target, info.Mode().Perm())
+	}
+	if err = os.MkdirAll(filepath.Dir(target), 0777); err != nil {
+		return err
+	}
+	if e.isTooLargeToRead(info) {
+		return tooLargeError
+	}
+	if target, err = resolveCollision(target, a.onCollision); err != nil {
+		return err
+	}
+	return copyEntry(source, target, info)
+}
+
+// chmodAction sets permission bits of found entries, symlinks are left intact as they have no permissions of their own
+type chmodAction struct {
+	mode os.FileMode
+}
+
+func (a *chmodAction) name() string {
+	return "chmod"
+}
+
+func (a *chmodAction) describe(e *Explorer, result Result) string {
+	info, err := os.Lstat(result.path())
+	if err != nil {
+		return err.Error()
+	}
+	return fmt.Sprintf("mode would change from %#o to %#o", info.Mode()&os.ModePerm, a.mode)
+}
+
+func (a *chmodAction) apply(e *Explorer, result Result) error {
+	info, err := os.Lstat(result.path())
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		return errors.New("symlink permissions can't be changed")
+	}
+	return os.Chmod(result.path(), a.mode)
+}
+
+// chownAction sets owner and group of found entries, -1 leaves respective id unchanged
+type chownAction struct {
+	uid int
+	gid int
+}
+
+func (a *chownAction) name() string {
+	return "chown"
+}
+
+func (a *chownAction) describe(e *Explorer, result Result) string {
+	info, err := os.Lstat(result.path())
+	if err != nil {
+		return err.Error()
+	}
+	stat := info.Sys().(*syscall.Stat_t)
+	uid, gid := a.uid, a.gid
+	if uid == -1 {
+		uid = int(stat.Uid)
+	}
+	if gid == -1 {
+		gid = int(stat.Gid)
+	}
+	return fmt.Sprintf("owner would change from %d:%d to %d:%d", stat.Uid, stat.Gid, uid, gid)
+}
+
+func (a *chownAction) apply(e *Explorer, result Result) error {
+	return os.Lchown(result.path(), a.uid, a.gid)
+}
+
+// touchAction sets access and modification times of found entries, to current time unless reference times are given.
+// Symlinks themselves are touched rather than their targets
+type touchAction struct {
+	reference    bool
+	atime, mtime time.Time
+}
+
+func (a *touchAction) name() string {
+	return "touch"
+}
+
+func (a *touchAction) times() (atime, mtime time.Time) {
+	if a.reference {
+		return a.atime, a.mtime
+	}
+	now := time.Now()
+	return now, now
+}
+
+func (a *touchAction) describe(e *Explorer, result Result) string {
+	atime, mtime := a.times()
+	return fmt.Sprintf("atime would be set to %d and mtime to %d", atime.Unix(), mtime.Unix())
+}
+
+func (a *touchAction) apply(e *Explorer, result Result) error {
+	atime, mtime := a.times()
+	times := []unix.Timespec{unix.NsecToTimespec(atime.UnixNano()), unix.NsecToTimespec(mtime.UnixNano())}
+	return unix.UtimesNanoAt(unix.AT_FDCWD, result.path(), times, unix.AT_SYMLINK_NOFOLLOW)
+}
+
+// isTooLargeToRead guards actions reading file content from spending the scan on few huge files
+func (e *Explorer) isTooLargeToRead(info os.FileInfo) bool {
+	return e.maxReadSize > 0 && info.Mode().IsRegular() && info.Size() > e.maxReadSize
+}
+
+// resolveCollision returns path to write target into according to the collision policy
+func resolveCollision(target string, policy string) (string, error) {
+	if _, err := os.Lstat(target); os.IsNotExist(err) {
+		return target, nil
+	} else if err != nil {
+		return "", err
+	}
+	switch policy {
+	case collisionOverwrite:
+		return target, nil
+	case collisionSuffix:
+		for i := 1; ; i++ {
+			candidate := fmt.Sprintf("%s.%d", target, i)
+			if _, err := os.Lstat(candidate); os.IsNotExist(err) {
+				return candidate, nil
+			}
+		}
+	default:
+		return "", errors.New(target + " already exists")
+	}
+}
+
+// copyEntry copies regular file or symlink, preserving permissions and modification time of the source
+func copyEntry(source, target string, info os.FileInfo) error {
+	switch {
+	case info.Mode().IsRegular():
+		return copyFile(source, target, info)
+	case info.Mode()&os.ModeSymlink != 0:
+		link, err := os.Readlink(source)
+		if err != nil {
+			return err
+		}
+		_ = os.Remove(target)
+		return os.Symlink(link, target)
+	default:
+		return errors.New("can't copy " + info.Mode().Type().String() + " entry")
+	}
+}
+
+func copyFile(source, target string, info os.FileInfo) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err = out.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(target, info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Chtimes(target, info.ModTime(), info.ModTime())
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestShredRefusesHardLinks(t *testing.T) {
+	dir := t.TempDir()
+	path, link := filepath.Join(dir, "file"), filepath.Join(dir, "link")
+	if err := os.WriteFile(path, []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(path, link); err != nil {
+		t.Fatal(err)
+	}
+	e := NewExplorer(context.Background())
+	deletion := &deleteAction{shredPasses: 1}
+	if outcome := e.applyAction(deletion, Result{name: path, dtype: syscall.DT_REG}); outcome != actionFailed {
+		t.Fatalf("expected shredding of hard linked file to fail, got %s", outcome)
+	}
+	if err := deletion.apply(e, Result{name: path, dtype: syscall.DT_REG}); !errors.Is(err, hardLinkedError) {
+		t.Fatalf("expected %v, got %v", hardLinkedError, err)
+	}
+	for _, name := range []string{path, link} {
+		if content, err := os.ReadFile(name); err != nil || string(content) != "content" {
+			t.Fatalf("expected %s to keep its content, got %q, %v", name, content, err)
+		}
+	}
+	if err := os.Remove(link); err != nil {
+		t.Fatal(err)
+	}
+	if err := deletion.apply(e, Result{name: path, dtype: syscall.DT_REG}); err != nil {
+		t.Fatalf("expected file without other links to be shredded and removed, got %v", err)
+	}
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected %s to be removed, got %v", path, err)
+	}
+}
+
+func TestSuccessMarkers(t *testing.T) {
+	SetLogLevel(levelWarn)
+	defer SetLogLevel(levelInfo)
+	for _, quiet := range []bool{false, true} {
+		root := makeTree(t, "a")
+		e := newTestExplorer()
+		e.SetIncludedTypes([]string{"file"})
+		e.actions = []action{&touchAction{}}
+		e.quiet = quiet
+		expected := filepath.Join(root, "a")
+		if !quiet {
+			expected += " [touch_success]"
+		}
+		if lines := scan(t, e, root); len(lines) != 1 || lines[0] != expected {
+			t.Fatalf("expected %q with quiet %v, got %q", expected, quiet, lines)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"golang.org/x/text/unicode/norm"
+)
+
+// archiveExtensions are suffixes of seeds scanned as pseudo-directories, with members listed as if they were files
+var archiveExtensions = []string{".tar", ".tar.gz", ".tgz", ".tar.zst", ".zip"}
+
+// IsArchive tells whether path is a regular file with one of archiveExtensions
+func IsArchive(path string) bool {
+	lower := strings.ToLower(path)
+	for _, ext := range archiveExtensions {
+		if strings.HasSuffix(lower, ext) {
+			info, err := os.Stat(path)
+			return err == nil && info.Mode().IsRegular()
+		}
+	}
+	return false
+}
+
+// listArchive calls handle for every member of archive, until it returns false
+func listArchive(archive string, handle func(name string, info os.FileInfo) bool) error {
+	if strings.HasSuffix(strings.ToLower(archive), ".zip") {
+		reader, err := zip.OpenReader(archive)
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		for _, member := range reader.File {
+			if !handle(member.Name, member.FileInfo()) {
+				return nil
+			}
+		}
+		return nil
+	}
+
+	file, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var stream io.Reader = file
+	lower := strings.ToLower(archive)
+	switch {
+	case strings.HasSuffix(lower, ".gz"), strings.HasSuffix(lower, ".tgz"):
+		decompressor, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer decompressor.Close()
+		stream = decompressor
+	case strings.HasSuffix(lower, ".zst"):
+		decompressor, err := zstd.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer decompressor.Close()
+		stream = decompressor
+	}
+	reader := tar.NewReader(stream)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !handle(header.Name, header.FileInfo()) {
+			return nil
+		}
+	}
+}
+
+// memberTimes returns atime, mtime and ctime of archive member, formats lacking atime or ctime report mtime instead
+func memberTimes(info os.FileInfo) (atime, mtime, ctime time.Time) {
+	mtime = info.ModTime()
+	atime, ctime = mtime, mtime
+	if header, ok := info.Sys().(*tar.Header); ok {
+		if !header.AccessTime.IsZero() {
+			atime = header.AccessTime
+		}
+		if !header.ChangeTime.IsZero() {
+			ctime = header.ChangeTime
+		}
+	}
+	return atime, mtime, ctime
+}
+
+// readArchive is readdir of archive seeds, members are filtered the same way as entries of real directories
+func (e *Explorer) readArchive(archive string) {
+	results := e.resultsPool.Get().([]Result)
+	defer e.putResults(results)
+
+	clearResults := func() {
+		if len(results) != 0 {
+			e.addResults(results)
+		}
+		results = results[:0]
+	}
+	defer clearResults()
+
+	sampler := e.newSampler(archive)
+	// Members of the same depth share their origin, as entries of a directory do
+	var origins []*dirTask
+	// Members of excluded directories are skipped, just like excluded directories are not descended into
+	var excludedDirs []string
+	err := listArchive(archive, func(name string, info os.FileInfo) bool {
+		if e.ctx.Err() != nil {
+			return false
+		}
+		if !filepath.IsLocal(filepath.Clean(name)) {
+			logWarnf("Skipped archive member outside of archive root: %s: %s", archive, name)
+			return true
+		}
+		fullpath := filepath.Join(archive, name)
+		for _, dir := range excludedDirs {
+			if strings.HasPrefix(fullpath, dir) {
+				return true
+			}
+		}
+		dtype := direntTypeOf(info.Mode())
+		isDir := dtype == syscall.DT_DIR
+		if e.isExcluded(fullpath) {
+			logDebugf("Excluded by pattern: %s", fullpath)
+			if isDir {
+				excludedDirs = append(excludedDirs, fullpath+string(filepath.Separator))
+			}
+			return true
+		}
+		if e.isNotIncluded(fullpath) || !e.includesType(dtype) || !e.matchesNameLength(len(filepath.Base(fullpath))) ||
+			e.nonNFC && norm.NFC.IsNormalString(filepath.Base(fullpath)) || e.hasACL || e.zeroBlocks || e.withData {
+			return true
+		}
+		depth := strings.Count(filepath.Clean(name), string(filepath.Separator)) + 1
+		for len(origins) < depth {
+			origins = append(origins, &dirTask{path: archive, seed: archive, depth: len(origins)})
+		}
+		result := Result{name: fullpath, dtype: dtype, extra: &resultExtra{info: info}, origin: origins[depth-1]}
+		if isDir {
+			result.name += string(filepath.Separator)
+		}
+		if e.needsTimes() {
+			atime, mtime, ctime := memberTimes(info)
+			if !e.checkTimeConditions(atime, mtime, ctime, &result) {
+				return true
+			}
+		}
+		if (e.executable || e.notExecutable) && (info.Mode()&0111 != 0) != e.executable {
+			return true
+		}
+		if sampler != nil && sampler.Float64() >= e.sampleRate {
+			return true
+		}
+		if e.state != nil && !e.state.changed(fullpath, info.ModTime(), info.Size()) {
+			return true
+		}
+		results = append(results, result)
+		if len(results) == e.batchSize {
+			clearResults()
+		}
+		return true
+	})
+	if err != nil {
+		e.reportError(archive, err)
+	}
+}
+
+// direntTypeOf maps file mode to the dirent type readdir would report for such file
+func direntTypeOf(mode os.FileMode) uint8 {
+	switch {
+	case mode.IsDir():
+		return syscall.DT_DIR
+	case mode&os.ModeSymlink != 0:
+		return syscall.DT_LNK
+	case mode&os.ModeSocket != 0:
+		return syscall.DT_SOCK
+	case mode&os.ModeNamedPipe != 0:
+		return syscall.DT_FIFO
+	case mode&os.ModeCharDevice != 0:
+		return syscall.DT_CHR
+	case mode&os.ModeDevice != 0:
+		return syscall.DT_BLK
+	case mode.IsRegular():
+		return syscall.DT_REG
+	}
+	return syscall.DT_UNKNOWN
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// column is an attribute of result in text output
+type column int
+
+const (
+	columnPath column = iota
+	columnInode
+	columnInodeHex
+	columnSize
+	columnAtime
+	columnMtime
+	columnCtime
+	columnFstype
+	columnRdev
+	columnScanTime
+	columnDirent
+	columnSeed
+	columnDepth
+	columnAbsPath
+	columnRelPath
+	columnMode
+)
+
+// scanTimeLayout is how scan time is printed, with precision enough to tell apart timing within a directory
+const scanTimeLayout = "2006-01-02T15:04:05.000000Z07:00"
+
+var columnNames = map[string]column{
+	"path":      columnPath,
+	"inode":     columnInode,
+	"inode-hex": columnInodeHex,
+	"size":      columnSize,
+	"atime":     columnAtime,
+	"mtime":     columnMtime,
+	"ctime":     columnCtime,
+	"fstype":    columnFstype,
+	"rdev":      columnRdev,
+	"scantime":  columnScanTime,
+	"dirent":    columnDirent,
+	"seed":      columnSeed,
+	"depth":     columnDepth,
+	"abspath":   columnAbsPath,
+	"relpath":   columnRelPath,
+	"mode":      columnMode,
+}
+
+// ParseColumns parses comma separated column names, in the order they should be printed
+func ParseColumns(value string) ([]column, error) {
+	var columns []column
+	for _, name := range strings.Split(value, ",") {
+		c, ok := columnNames[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q, possible values: path, inode, inode-hex, size, atime, mtime, ctime, fstype, rdev, scantime, dirent, seed, depth, abspath, relpath, mode", name)
+		}
+		columns = append(columns, c)
+	}
+	return columns, nil
+}
+
+// SetColumns chooses attributes printed for results and their order. Only attributes requested are statted
+func (e *Explorer) SetColumns(columns []column) {
+	e.columns = columns
+	e.inodes, e.inodesHex, e.withSizes, e.withTimes, e.withFstype, e.withRdev, e.withScanTime, e.withDirent, e.withSeed, e.withDepth, e.withMode = false, false, false, false, false, false, false, false, false, false, false
+	for _, c := range columns {
+		switch c {
+		case columnInode:
+			e.inodes = true
+		case columnInodeHex:
+			e.inodesHex = true
+		case columnSize:
+			e.withSizes = true
+		case columnAtime, columnMtime, columnCtime:
+			e.withTimes = true
+		case columnFstype:
+			e.withFstype = true
+		case columnRdev:
+			e.withRdev = true
+		case columnScanTime:
+			e.withScanTime = true
+		case columnDirent:
+			e.withDirent = true
+		case columnSeed:
+			e.withSeed = true
+		case columnDepth:
+			e.withDepth = true
+		case columnMode:
+			e.withMode = true
+		}
+	}
+}
+
+// outputColumns returns columns set by SetColumns, or the ones implied by --inodes, --with-size and similar flags.
+// Columns are fixed on start
+func (e *Explorer) outputColumns() []column {
+	if e.columns != nil {
+		return e.columns
+	}
+	columns := []column{columnPath}
+	if e.inodes {
+		columns = append(columns, columnInode)
+	}
+	if e.inodesHex {
+		columns = append(columns, columnInodeHex)
+	}
+	if e.withSizes {
+		columns = append(columns, columnSize)
+	}
+	if e.withTimes {
+		columns = append(columns, columnAtime, columnMtime, columnCtime)
+	}
+	if e.withFstype {
+		columns = append(columns, columnFstype)
+	}
+	if e.withRdev {
+		columns = append(columns, columnRdev)
+	}
+	if e.withScanTime {
+		columns = append(columns, columnScanTime)
+	}
+	if e.withDirent {
+		columns = append(columns, columnDirent)
+	}
+	if e.withSeed {
+		columns = append(columns, columnSeed)
+	}
+	if e.withDepth {
+		columns = append(columns, columnDepth)
+	}
+	if e.withMode {
+		columns = append(columns, columnMode)
+	}
+	return columns
+}
+
+// hasColumn tells whether c is printed
+func (e *Explorer) hasColumn(c column) bool {
+	for _, current := range e.outputColumns() {
+		if current == c {
+			return true
+		}
+	}
+	return false
+}
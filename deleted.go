@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// deletedSuffix is appended by kernel to /proc/<pid>/fd link targets of unlinked files
+const deletedSuffix = " (deleted)"
+
+// deletedOpenFile is a file removed from filesystem, but still held open and consuming space
+type deletedOpenFile struct {
+	path string
+	pid  int
+	fd   int
+	size int64
+}
+
+// findDeletedOpen lists open file descriptors of all processes under procRoot pointing to deleted files
+func findDeletedOpen(procRoot string, threads int) ([]deletedOpenFile, error) {
+	processes, err := os.ReadDir(procRoot)
+	if err != nil {
+		return nil, err
+	}
+	var lock sync.Mutex
+	var found []deletedOpenFile
+	workers := semaphore.NewWeighted(int64(threads))
+	ctx := context.TODO()
+	for _, process := range processes {
+		pid, err := strconv.Atoi(process.Name())
+		if err != nil {
+			continue
+		}
+		_ = workers.Acquire(ctx, 1)
+		go func() {
+			defer workers.Release(1)
+			files := findProcessDeletedOpen(filepath.Join(procRoot, process.Name(), "fd"), pid)
+			lock.Lock()
+			found = append(found, files...)
+			lock.Unlock()
+		}()
+	}
+	_ = workers.Acquire(ctx, int64(threads))
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].size != found[j].size {
+			return found[i].size > found[j].size
+		}
+		if found[i].pid != found[j].pid {
+			return found[i].pid < found[j].pid
+		}
+		return found[i].fd < found[j].fd
+	})
+	return found, nil
+}
+
+// findProcessDeletedOpen checks descriptors in fdDir of a single process, processes exiting or not accessible are skipped
+func findProcessDeletedOpen(fdDir string, pid int) []deletedOpenFile {
+	descriptors, err := os.ReadDir(fdDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logDebugf("%v", err)
+		}
+		return nil
+	}
+	var found []deletedOpenFile
+	for _, descriptor := range descriptors {
+		fd, err := strconv.Atoi(descriptor.Name())
+		if err != nil {
+			continue
+		}
+		link := filepath.Join(fdDir, descriptor.Name())
+		target, err := os.Readlink(link)
+		if err != nil || !strings.HasSuffix(target, deletedSuffix) || !strings.HasPrefix(target, "/") {
+			continue
+		}
+		// Stat follows the magic link to the open file itself, even though it has no name anymore
+		info, err := os.Stat(link)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		found = append(found, deletedOpenFile{
+			path: strings.TrimSuffix(target, deletedSuffix),
+			pid:  pid,
+			fd:   fd,
+			size: info.Size(),
+		})
+	}
+	return found
+}
+
+// writeDeletedOpen prints deleted open files as path, pid, fd and size, largest first
+func (e *Explorer) writeDeletedOpen(out io.Writer, files []deletedOpenFile) {
+	for _, file := range files {
+		terminator := "\n"
+		if e.print0 {
+			terminator = "\x00"
+		}
+		fmt.Fprintf(out, "%s %d %d %d%s", e.formatName(file.path), file.pid, file.fd, file.size, terminator)
+	}
+}
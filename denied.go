@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"slices"
+	"sync"
+)
+
+// deniedDirs collects directories which couldn't be read for lack of permissions, set by --report-denied.
+// These are expected when scanning as non-root, so instead of an error each they are listed once the scan ends
+type deniedDirs struct {
+	sync.Mutex
+	dirs map[string]null
+}
+
+func newDeniedDirs() *deniedDirs {
+	return &deniedDirs{dirs: make(map[string]null)}
+}
+
+func (d *deniedDirs) add(dir string) {
+	d.Lock()
+	defer d.Unlock()
+	d.dirs[dir] = nullv
+}
+
+func (d *deniedDirs) count() int {
+	d.Lock()
+	defer d.Unlock()
+	return len(d.dirs)
+}
+
+// write lists denied directories sorted, one per line, each rendered by format
+func (d *deniedDirs) write(out io.Writer, format func(string) string) error {
+	d.Lock()
+	dirs := make([]string, 0, len(d.dirs))
+	for dir := range d.dirs {
+		dirs = append(dirs, dir)
+	}
+	d.Unlock()
+	slices.Sort(dirs)
+	writer := bufio.NewWriter(out)
+	for _, dir := range dirs {
+		writer.WriteString(format(dir) + "\n")
+	}
+	return writer.Flush()
+}
+
+// writeDenied lists denied directories to file at path, or to stderr after a warning if path is empty.
+// The file is created even if there are none, so an empty one tells nothing was denied
+func (e *Explorer) writeDenied(path string) error {
+	count := e.denied.count()
+	if path == "" {
+		if count == 0 {
+			return nil
+		}
+		logWarnf("%d directories couldn't be read for lack of permissions, results are incomplete:", count)
+		return e.denied.write(os.Stderr, e.formatName)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := e.denied.write(file, e.formatName); err != nil {
+		file.Close()
+		return err
+	}
+	if count != 0 {
+		logWarnf("%d directories couldn't be read for lack of permissions, results are incomplete. Listed in %s", count, path)
+	}
+	return file.Close()
+}
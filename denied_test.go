@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDeniedDirsCountAsErrors(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("permissions are not enforced for root")
+	}
+	root := makeTree(t, "open/file", "closed/file")
+	closed := filepath.Join(root, "closed")
+	if err := os.Chmod(closed, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(closed, 0755)
+	e := newTestExplorer()
+	e.denied = newDeniedDirs()
+	scan(t, e, root)
+	if errors := atomic.LoadInt64(&e.errorCount); errors != 1 {
+		t.Fatalf("expected denied directory to be counted as an error, got %d errors", errors)
+	}
+	var listed bytes.Buffer
+	if err := e.denied.write(&listed, e.formatName); err != nil {
+		t.Fatal(err)
+	}
+	if listed.String() != closed+"\n" {
+		t.Fatalf("expected %s to be listed as denied, got %q", closed, listed.String())
+	}
+}
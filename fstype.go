@@ -0,0 +1,14 @@
+package main
+
+import "strconv"
+
+// fsTypeName returns name of filesystem type, or its magic number in hex if unknown
+func fsTypeName(fsType int64) string {
+	if name, ok := fsTypeNames[fsType]; ok {
+		return name
+	}
+	if fsType == 0 {
+		return "unknown"
+	}
+	return "0x" + strconv.FormatInt(fsType, 16)
+}
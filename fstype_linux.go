@@ -0,0 +1,55 @@
+//go:build linux
+// +build linux
+
+package main
+
+import "golang.org/x/sys/unix"
+
+// fsTypeNames maps statfs f_type magic numbers to filesystem names, as in /proc/filesystems
+var fsTypeNames = map[int64]string{
+	unix.AUTOFS_SUPER_MAGIC:    "autofs",
+	unix.BCACHEFS_SUPER_MAGIC:  "bcachefs",
+	unix.BPF_FS_MAGIC:          "bpf",
+	unix.BTRFS_SUPER_MAGIC:     "btrfs",
+	unix.CEPH_SUPER_MAGIC:      "ceph",
+	unix.CGROUP2_SUPER_MAGIC:   "cgroup2",
+	unix.CGROUP_SUPER_MAGIC:    "cgroup",
+	unix.CIFS_SUPER_MAGIC:      "cifs",
+	unix.DEBUGFS_MAGIC:         "debugfs",
+	unix.DEVPTS_SUPER_MAGIC:    "devpts",
+	unix.ECRYPTFS_SUPER_MAGIC:  "ecryptfs",
+	unix.EFIVARFS_MAGIC:        "efivarfs",
+	unix.EXFAT_SUPER_MAGIC:     "exfat",
+	unix.EXT4_SUPER_MAGIC:      "ext4",
+	unix.F2FS_SUPER_MAGIC:      "f2fs",
+	unix.FUSE_SUPER_MAGIC:      "fuse",
+	unix.HUGETLBFS_MAGIC:       "hugetlbfs",
+	unix.ISOFS_SUPER_MAGIC:     "iso9660",
+	unix.MSDOS_SUPER_MAGIC:     "vfat",
+	unix.NFS_SUPER_MAGIC:       "nfs",
+	unix.NILFS_SUPER_MAGIC:     "nilfs2",
+	unix.OCFS2_SUPER_MAGIC:     "ocfs2",
+	unix.OVERLAYFS_SUPER_MAGIC: "overlay",
+	unix.PROC_SUPER_MAGIC:      "proc",
+	unix.PSTOREFS_MAGIC:        "pstore",
+	unix.RAMFS_MAGIC:           "ramfs",
+	unix.REISERFS_SUPER_MAGIC:  "reiserfs",
+	unix.SECURITYFS_MAGIC:      "securityfs",
+	unix.SELINUX_MAGIC:         "selinuxfs",
+	unix.SMB2_SUPER_MAGIC:      "smb3",
+	unix.SMB_SUPER_MAGIC:       "smb",
+	unix.SQUASHFS_MAGIC:        "squashfs",
+	unix.SYSFS_MAGIC:           "sysfs",
+	unix.TMPFS_MAGIC:           "tmpfs",
+	unix.TRACEFS_MAGIC:         "tracefs",
+	unix.UDF_SUPER_MAGIC:       "udf",
+	unix.V9FS_MAGIC:            "9p",
+	unix.XFS_SUPER_MAGIC:       "xfs",
+	unix.ZONEFS_MAGIC:          "zonefs",
+	0x2fc12fc1:                 "zfs",
+	0x0bd00bd0:                 "lustre",
+	0x47504653:                 "gpfs",
+	0x19830326:                 "beegfs",
+	0x01161970:                 "gfs2",
+	0x5346544e:                 "ntfs",
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+// fsTypeNames is empty outside of Linux, where statfs f_type is not a magic number of filesystem
+var fsTypeNames = map[int64]string{}
@@ -5,7 +5,8 @@ go 1.22.5
 require (
 	github.com/gobwas/glob v0.2.3
 	github.com/jessevdk/go-flags v1.6.1
+	github.com/klauspost/compress v1.18.0
 	golang.org/x/sync v0.8.0
+	golang.org/x/sys v0.26.0
+	golang.org/x/text v0.19.0
 )
-
-require golang.org/x/sys v0.26.0 // indirect
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+	levelFatal
+)
+
+var logLevelNames = map[logLevel]string{
+	levelDebug: "DEBUG",
+	levelInfo:  "INFO",
+	levelWarn:  "WARN",
+	levelError: "ERROR",
+	levelFatal: "FATAL",
+}
+
+var (
+	logger          = log.New(os.Stderr, "", log.LstdFlags)
+	currentLogLevel = levelInfo
+)
+
+func (l logLevel) String() string {
+	return logLevelNames[l]
+}
+
+// ParseLogLevel converts level name, as accepted by --log-level, into logLevel
+func ParseLogLevel(name string) (logLevel, error) {
+	for level, levelName := range logLevelNames {
+		if strings.EqualFold(name, levelName) && level != levelFatal {
+			return level, nil
+		}
+	}
+	return levelInfo, fmt.Errorf("unknown log level %q, possible values: debug, info, warn, error", name)
+}
+
+// SetLogLevel sets minimal level of messages to be logged, fatal messages are logged regardless
+func SetLogLevel(level logLevel) {
+	currentLogLevel = level
+}
+
+// SetLogOutput redirects log messages, e.g. for embedding Explorer into another program
+func SetLogOutput(w io.Writer) {
+	logger.SetOutput(w)
+}
+
+func logEnabled(level logLevel) bool {
+	return level >= currentLogLevel
+}
+
+func logf(level logLevel, format string, v ...interface{}) {
+	if !logEnabled(level) {
+		return
+	}
+	logger.Output(3, level.String()+" "+fmt.Sprintf(format, v...))
+}
+
+func logDebugf(format string, v ...interface{}) {
+	logf(levelDebug, format, v...)
+}
+
+func logInfof(format string, v ...interface{}) {
+	logf(levelInfo, format, v...)
+}
+
+func logWarnf(format string, v ...interface{}) {
+	logf(levelWarn, format, v...)
+}
+
+func logErrorf(format string, v ...interface{}) {
+	logf(levelError, format, v...)
+}
+
+// logTracef logs regardless of level, for --trace-scheduler. Callers check the flag first,
+// so tracing costs nothing when it is off
+func logTracef(format string, v ...interface{}) {
+	logger.Output(2, "TRACE "+fmt.Sprintf(format, v...))
+}
+
+func logFatalf(format string, v ...interface{}) {
+	logf(levelFatal, format, v...)
+	os.Exit(1)
+}
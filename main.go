@@ -5,11 +5,16 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	_ "net/http/pprof"
 	"os"
 	"path"
 	"path/filepath"
-	"strconv"
+	"slices"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"syscall"
@@ -17,6 +22,8 @@ import (
 	"unsafe"
 
 	"golang.org/x/sync/semaphore"
+	"golang.org/x/sys/unix"
+	"golang.org/x/text/unicode/norm"
 
 	"github.com/gobwas/glob"
 	"github.com/jessevdk/go-flags"
@@ -44,11 +51,16 @@ type controlChannel chan null
 const direntNameOffset = uint64(unsafe.Offsetof(syscall.Dirent{}.Name))
 
 var timeoutError = errors.New("timed out")
+var maxRuntimeError = errors.New("max runtime exceeded")
+var limitReachedError = errors.New("limit of results reached")
+var maxBytesReachedError = errors.New("limit of found bytes reached")
+var maxErrorsError = errors.New("too many errors")
+var outputError = errors.New("failed to write output")
 var Version = "v0.1.0"
 
 type dirStore struct {
 	sync.Mutex
-	store []string
+	store []dirTask
 }
 
 type resultStore struct {
@@ -60,9 +72,126 @@ type resultStore struct {
 type Result struct {
 	name  string
 	ino   uint64
+	dev   uint64
+	dtype uint8
 	atime time.Time
 	mtime time.Time
 	ctime time.Time
+	// extra holds attributes set only for some entries or with some options, nil otherwise
+	extra *resultExtra
+	// summary is set for directories output by --tree-summary, instead of their entries
+	summary *dirSummary
+	// origin is task of the directory entry was found in, shared by all its entries for their seed and depth.
+	// Entries not found by reading a directory, like seeds and archive members, get one of their own
+	origin *dirTask
+	// dir is open directory of entry for --delete to unlink relative to, if it is kept open
+	dir *dirHandle
+}
+
+// resultExtra holds attributes of Result which most scans don't need, so they cost a single pointer then
+type resultExtra struct {
+	// fstype is statfs f_type of the filesystem entry resides on, only set with --with-fstype
+	fstype int64
+	// info is set for entries not residing on filesystem, like archive members, and used instead of stat
+	info os.FileInfo
+	// reclen and direntType are length and type of the raw dirent record, only set with --with-dirent.
+	// Type is as read, DT_UNKNOWN even if the type of entry was resolved by stat
+	reclen     uint16
+	direntType uint8
+}
+
+// seed returns the searched directory entry was found under
+func (r Result) seed() string {
+	return r.origin.seed
+}
+
+// depth returns number of path components below the seed, zero for seeds themselves
+func (r Result) depth() int {
+	return r.origin.depth + 1
+}
+
+func (r Result) fstype() int64 {
+	if r.extra == nil {
+		return 0
+	}
+	return r.extra.fstype
+}
+
+func (r Result) info() os.FileInfo {
+	if r.extra == nil {
+		return nil
+	}
+	return r.extra.info
+}
+
+// dirent returns length and type of the raw dirent record, zero length for entries not read from a directory like seeds
+func (r Result) dirent() (reclen uint16, direntType uint8) {
+	if r.extra == nil {
+		return 0, 0
+	}
+	return r.extra.reclen, r.extra.direntType
+}
+
+// maxHeldDirs limits directories kept open for results waiting for --delete and for subdirectories with too long paths,
+// the rest are removed or opened by path
+const maxHeldDirs = 1024
+
+// dirHandle keeps directory open while its results wait for --delete, so they are unlinked relative to it
+// without resolving their full paths again, and regardless of renames of their ancestors.
+// Subdirectories which paths exceed PATH_MAX are opened relative to it as well.
+// It is closed once the directory is read and all results and subdirectories referencing it are done with it
+type dirHandle struct {
+	file *os.File
+	refs int32
+	held *int64
+}
+
+func (h *dirHandle) acquire() {
+	atomic.AddInt32(&h.refs, 1)
+}
+
+func (h *dirHandle) release() {
+	if h != nil && atomic.AddInt32(&h.refs, -1) == 0 {
+		h.file.Close()
+		atomic.AddInt64(h.held, -1)
+	}
+}
+
+// releaseDirs releases directories of results dropped without being written
+func releaseDirs(results []Result) {
+	for _, result := range results {
+		result.dir.release()
+	}
+}
+
+// releaseParents releases parent directories of tasks dropped without being read
+func releaseParents(tasks []dirTask) {
+	for _, task := range tasks {
+		task.parent.release()
+	}
+}
+
+// dirSummary counts entries of a single directory which passed filters, without descending into subdirectories
+type dirSummary struct {
+	files int64
+	dirs  int64
+	size  int64
+	// types counts entries per dirent type for --dir-report-json, nil otherwise
+	types map[uint8]int64
+}
+
+// path returns name of the entry without trailing separator of directories
+func (r Result) path() string {
+	if len(r.name) > 1 {
+		return strings.TrimSuffix(r.name, string(filepath.Separator))
+	}
+	return r.name
+}
+
+// inodeRange is an inclusive range of inode numbers
+type inodeRange struct {
+	from uint64
+	to   uint64
 }
 
 // TimeCondition represents conditions to filter by a specific time type
@@ -72,63 +201,187 @@ type TimeCondition struct {
 }
 
 type Explorer struct {
-	directories         chan string
+	directories         chan dirTask
 	dirStore            dirStore
 	resultStore         resultStore
 	inFlight            int64
+	pathsTooLong        int64
+	largeDirsSkipped    int64
+	largeDirsPruned     int64
+	found               int64
+	dirsScanned         int64
+	errorCount          int64
+	bytesFound          int64
+	startTime           time.Time
+	limit               int64
+	chunk               int
+	maxBytes            int64
 	resilient           bool
+	maxErrors           int64
+	retries             int
 	inodes              bool
 	inodesHex           bool
 	raw                 bool
+	quoteWhenNeeded     bool
+	linePrefix          string
+	lineSuffix          string
+	print0              bool
+	json                bool
+	jsonArray           bool
+	columns             []column
+	output              io.Writer
 	timeout             time.Duration
 	doneTails           controlChannel
 	doneDirectories     controlChannel
 	doneDirectoriesFlag bool
 	ctx                 context.Context
+	cancel              context.CancelCauseFunc
 	excludes            []glob.Glob
+	skipPaths           []string
+	skipHiddenDirs      bool
+	denied              *deniedDirs
 	includes            []glob.Glob
+	includeGroups       [][]glob.Glob
+	excludeInodes       map[uint64]null
+	excludeInodeRanges  []inodeRange
+	ownFiles            atomic.Pointer[[]fileID]
+	ownFilesLock        sync.Mutex
 	flushStoreRequest   controlChannel
 	threads             int64
 	rateLimiter         chan null
+	threadsPerMount     int
+	mountSlots          *mountSlots
+	statLimiter         chan null
+	statThreads         int
+	readdirplus         bool
+	skipLargeDirs       int
+	maxDirEntries       int
+	perDirLimit         int
 	buffPool            sync.Pool
 	resultsPool         sync.Pool
-	debugInFlight       int64
-
-	atimeOlderThan time.Duration
-	atimeNewerThan time.Duration
-	mtimeOlderThan time.Duration
-	mtimeNewerThan time.Duration
-	ctimeOlderThan time.Duration
-	ctimeNewerThan time.Duration
-
-	delete         bool
-	deleteAll      bool
-	includeDirs    bool
-	includeFiles   bool
-	includeLinks   bool
-	includeSocket  bool
-	includeAny     bool
-	started        bool
-	resultsThreads int
-	withSizes      bool
-	withTimes      bool
+	lowMemory           bool
+	traceScheduler      bool
+	descriptorsHint     sync.Once
+	// dirsOutput receives directory results instead of output, if set by --dirs-to
+	dirsOutput io.Writer
+
+	atimeOlderThan TimeFilter
+	atimeNewerThan TimeFilter
+	mtimeOlderThan TimeFilter
+	mtimeNewerThan TimeFilter
+	ctimeOlderThan TimeFilter
+	ctimeNewerThan TimeFilter
+	changedWithin  TimeFilter
+	future         bool
+
+	actions         []action
+	summary         actionSummary
+	reports         []report
+	dryRun          bool
+	quiet           bool
+	maxReadSize     int64
+	pruneEmpty      bool
+	emptyCandidates emptyCandidates
+	seeds           []string
+	relativeTo      string
+	workingDir      string
+	stripPrefix     string
+	realPath        bool
+	addPrefix       string
+	archives        map[string]null
+	includeDirs     bool
+	includeFiles    bool
+	includeLinks    bool
+	includeSocket   bool
+	includeChar     bool
+	includeBlock    bool
+	includeUnknown  bool
+	includeAny      bool
+	started         bool
+	orderedOutput   bool
+	uniqueInodes    bool
+	seenPaths       *seenPaths
+	resultsThreads  int
+	batchSize       int
+	withSizes       bool
+	withTimes       bool
+	withFstype      bool
+	withRdev        bool
+	withScanTime    bool
+	withDirent      bool
+	withSeed        bool
+	withDepth       bool
+	withMode        bool
+	treeSummary     bool
+	summaryTypes    bool
+	nameLonger      int
+	nameShorter     int
+	nonNFC          bool
+	hasACL          bool
+	noACL           bool
+	executable      bool
+	notExecutable   bool
+	zeroBlocks      bool
+	withData        bool
+	sampleRate      float64
+	sampleSeed      uint64
+	// matchAbsolute makes --exclude and --filter patterns match absolute paths, set by --match-absolute
+	matchAbsolute bool
+	// resultSlots limits concurrently processed batches per directory, set by --result-jobs-per-dir
+	resultSlots *resultSlots
+
+	// state filters out entries unchanged since the previous scan, set by --state
+	state *scanState
+	// unlinkAt keeps directories open for --delete of their entries, held counts them
+	unlinkAt bool
+	heldDirs int64
+
+	// readDirentSyscall reads entries of directory, tests replace it to simulate slow filesystems
+	readDirentSyscall func(fd int, buf []byte) (int, error)
 }
 
 func NewExplorer(ctx context.Context) *Explorer {
 	e := &Explorer{}
 	e.doneTails = make(controlChannel)
 	e.doneDirectories = make(controlChannel)
-	e.ctx = ctx
+	e.ctx, e.cancel = context.WithCancelCause(ctx)
+	e.resilient = true
+	e.timeout = 5 * time.Minute
+	e.resultsThreads = 128
+	e.batchSize = 1024
+	e.output = os.Stdout
 	e.buffPool.New = func() interface{} {
 		return make([]byte, 64*1024)
 	}
+	e.readDirentSyscall = syscall.ReadDirent
 	e.resultsPool.New = func() interface{} {
-		return make([]Result, 0, 1024)
+		return make([]Result, 0, e.batchSize)
 	}
 	return e
 }
+
+// SetLowMemory trades throughput for lower peak memory: directories are read with smaller buffers,
+// so with more syscalls, and batches of results are allocated as they grow instead of being pooled
+func (e *Explorer) SetLowMemory() {
+	e.lowMemory = true
+	e.buffPool.New = func() interface{} {
+		return make([]byte, 8*1024)
+	}
+	e.resultsPool.New = func() interface{} {
+		return []Result(nil)
+	}
+}
+
+// putResults returns batch of results to the pool, unless pooling is disabled by --low-memory
+func (e *Explorer) putResults(results []Result) {
+	if !e.lowMemory {
+		e.resultsPool.Put(results)
+	}
+}
+
+// SetIncludedTypes sets types of entries to search, each value is a single type or comma separated list of them
 func (e *Explorer) SetIncludedTypes(types []string) {
-	for _, t := range types {
+	for _, t := range splitTypes(types) {
 		switch t {
 		case "file":
 			e.includeFiles = true
@@ -138,28 +391,39 @@ func (e *Explorer) SetIncludedTypes(types []string) {
 			e.includeLinks = true
 		case "socket":
 			e.includeSocket = true
+		case "char":
+			e.includeChar = true
+		case "block":
+			e.includeBlock = true
+		case "unknown":
+			e.includeUnknown = true
 		case "all":
 			e.includeAny = true
 		}
 	}
 }
 
+// splitTypes flattens --type values, so both -t file -t dir and -t file,dir are accepted
+func splitTypes(types []string) []string {
+	var split []string
+	for _, t := range types {
+		for _, part := range strings.Split(t, ",") {
+			split = append(split, strings.TrimSpace(part))
+		}
+	}
+	return split
+}
+
 func (e *Explorer) SetThreads(threads int) {
 	if e.started {
-		log.Fatalln("Can't change number of threads after start")
+		logFatalf("Can't change number of threads after start")
 	}
 	e.threads = int64(threads)
 	chanBuff := e.threads
 	if chanBuff < 4096 {
 		chanBuff = 4096
 	}
-	e.directories = make(chan string, chanBuff)
-	//go func() {
-	//	for {
-	//		time.Sleep(100 * time.Millisecond)
-	//		log.Println(e.debugInFlight)
-	//	}
-	//}()
+	e.directories = make(chan dirTask, chanBuff)
 }
 
 // checkTimeCondition checks if a given timestamp meets the specified TimeCondition
@@ -185,37 +449,73 @@ func checkTimeCondition(timestamp time.Time, condition TimeCondition) bool {
 	return true
 }
 
-// checkFileTimeConditions retrieves file times and checks them against the given conditions
-func (e *Explorer) checkFileTimeConditions(fullpath string) (Result, bool, error) {
+// needsTimes tells whether entries must be statted for times, either to filter or to output them
+func (e *Explorer) needsTimes() bool {
+	return e.atimeOlderThan.IsSet() || e.atimeNewerThan.IsSet() || e.ctimeOlderThan.IsSet() || e.ctimeNewerThan.IsSet() ||
+		e.mtimeOlderThan.IsSet() || e.mtimeNewerThan.IsSet() || e.changedWithin.IsSet() || e.future || e.withTimes
+}
+
+// checkFileTimeConditions retrieves file times into result and checks them against the given conditions.
+// File is statted by name relative to dirfd, which is unix.AT_FDCWD for names being full paths
+func (e *Explorer) checkFileTimeConditions(dirfd int, name, fullpath string, result *Result) (bool, error) {
 	// Retrieve atime, ctime, and mtime of the file
-	atime, mtime, ctime, err := GetFileTimes(fullpath)
+	var stat unix.Stat_t
+	release := e.statSlot()
+	err := unix.Fstatat(dirfd, name, &stat, 0)
+	release()
 	if err != nil {
-		log.Println(err)
-		return Result{}, false, err
+		err = &os.PathError{Op: "stat", Path: fullpath, Err: err}
+		logWarnf("%v", err)
+		return false, err
 	}
+	atime := time.Unix(stat.Atim.Unix())
+	mtime := time.Unix(stat.Mtim.Unix())
+	ctime := time.Unix(stat.Ctim.Unix())
+	return e.checkTimeConditions(atime, mtime, ctime, result), nil
+}
 
+// checkTimeConditions checks file times against the given conditions for type of result and stores them into result if they match
+func (e *Explorer) checkTimeConditions(atime, mtime, ctime time.Time, result *Result) bool {
+	for _, filter := range []TimeFilter{e.atimeOlderThan, e.atimeNewerThan, e.ctimeOlderThan, e.ctimeNewerThan, e.mtimeOlderThan, e.mtimeNewerThan, e.changedWithin} {
+		if filter.Excludes(result.dtype) {
+			return false
+		}
+	}
 	// Create time conditions based on the Explorer's settings
-	atimeCond := createTimeConditions(&e.atimeOlderThan, &e.atimeNewerThan)
-	ctimeCond := createTimeConditions(&e.ctimeOlderThan, &e.ctimeNewerThan)
-	mtimeCond := createTimeConditions(&e.mtimeOlderThan, &e.mtimeNewerThan)
+	atimeOlderThan, atimeNewerThan := e.atimeOlderThan.For(result.dtype), e.atimeNewerThan.For(result.dtype)
+	ctimeOlderThan, ctimeNewerThan := e.ctimeOlderThan.For(result.dtype), e.ctimeNewerThan.For(result.dtype)
+	mtimeOlderThan, mtimeNewerThan := e.mtimeOlderThan.For(result.dtype), e.mtimeNewerThan.For(result.dtype)
+	atimeCond := createTimeConditions(&atimeOlderThan, &atimeNewerThan)
+	ctimeCond := createTimeConditions(&ctimeOlderThan, &ctimeNewerThan)
+	mtimeCond := createTimeConditions(&mtimeOlderThan, &mtimeNewerThan)
 
 	if !checkTimeCondition(atime, atimeCond) {
-		return Result{}, false, nil
+		return false
 	}
 	if !checkTimeCondition(ctime, ctimeCond) {
-		return Result{}, false, nil
+		return false
 	}
 	if !checkTimeCondition(mtime, mtimeCond) {
-		return Result{}, false, nil
+		return false
+	}
+	if changedWithin := e.changedWithin.For(result.dtype); changedWithin != 0 {
+		cond := TimeCondition{NewerThan: changedWithin}
+		if !checkTimeCondition(atime, cond) && !checkTimeCondition(mtime, cond) && !checkTimeCondition(ctime, cond) {
+			return false
+		}
+	}
+	if e.future {
+		now := time.Now()
+		if !mtime.After(now) && !ctime.After(now) {
+			return false
+		}
 	}
 
 	// All conditions passed
-	return Result{
-		name:  fullpath,
-		atime: atime,
-		mtime: mtime,
-		ctime: ctime,
-	}, true, nil
+	result.atime = atime
+	result.mtime = mtime
+	result.ctime = ctime
+	return true
 }
 
 // createTimeConditions creates and returns the TimeCondition structs for time
@@ -246,13 +546,11 @@ func createTimeConditions(olderThanInput, newerThanInput *time.Duration) (timeCo
 // GetFileTimes returns the atime, mtime, and ctime of a file
 func GetFileTimes(path string) (atime, mtime, ctime time.Time, err error) {
 
-	fileInfo, err := os.Stat(path)
-	if err != nil {
-		return time.Time{}, time.Time{}, time.Time{}, err
+	var stat unix.Stat_t
+	if err := unix.Stat(path, &stat); err != nil {
+		return time.Time{}, time.Time{}, time.Time{}, &os.PathError{Op: "stat", Path: path, Err: err}
 	}
 
-	stat := fileInfo.Sys().(*syscall.Stat_t)
-
 	// Extract access time (atime)
 	atime = time.Unix(stat.Atim.Sec, stat.Atim.Nsec)
 
@@ -265,82 +563,106 @@ func GetFileTimes(path string) (atime, mtime, ctime time.Time, err error) {
 	return atime, mtime, ctime, nil
 }
 
+// statSlot blocks until another stat is allowed by --stat-jobs and returns function releasing it.
+// Stats are limited so filters and outputs requiring them don't overwhelm metadata servers
+func (e *Explorer) statSlot() (release func()) {
+	if e.statLimiter == nil {
+		return func() {}
+	}
+	e.statLimiter <- nullv
+	return func() { <-e.statLimiter }
+}
+
+// limitStat calls stat (os.Stat or os.Lstat) within --stat-jobs limit
+func (e *Explorer) limitStat(stat func(string) (os.FileInfo, error), path string) (os.FileInfo, error) {
+	defer e.statSlot()()
+	return stat(path)
+}
+
+// outputFailed aborts the scan once results can't be written, nothing found afterwards could be written either
+func (e *Explorer) outputFailed(err error) {
+	e.cancel(fmt.Errorf("%w: %v", outputError, err))
+}
+
 func (e *Explorer) dumpResults() {
 	defer func() { e.doneTails <- nullv }()
-	var done int64
 	var outputBuffer bytes.Buffer
-	var result Result
 
 	var writeSliceLock sync.WaitGroup
 	var writeLock sync.Mutex
+	// Batches are numbered in the order they were taken from resultStore,
+	// with ordered output each batch waits for its turn before writing
+	var batches, nextBatch uint64
+	// Number of results handed to workers, batches are cut here to honour --limit exactly
+	var taken int64
+	// Whether any element of --json-array was written, so the next one needs a separator
+	var arrayStarted bool
+	// Number of results written with --chunk, an empty record separates every chunk of them
+	var chunked int
+	if e.jsonArray {
+		outputBuffer.WriteString("[")
+	}
+	writeTurn := sync.NewCond(&writeLock)
 	resultsWorkers := semaphore.NewWeighted(int64(e.resultsThreads))
 
 	flush := func() {
-		fmt.Print(outputBuffer.String())
+		if _, err := e.output.Write(outputBuffer.Bytes()); err != nil {
+			e.outputFailed(err)
+		}
 		outputBuffer.Truncate(0)
 	}
 	defer flush()
 	defer writeSliceLock.Wait()
 	ctx := context.TODO()
 
-	writeData := func(data []Result) {
-		writeLock.Lock()
-		for _, result = range data {
-			done++
-			if e.raw {
-				outputBuffer.WriteString(fmt.Sprintf("%#v", result.name))
+	writeData := func(batch uint64, data []Result) {
+		var batchBuffer, dirsBuffer bytes.Buffer
+		// Offsets of results ends in batchBuffer, to separate chunks between them
+		var ends []int
+		for _, result := range data {
+			if e.dirsOutput != nil && result.dtype == syscall.DT_DIR {
+				e.writeResult(result, &dirsBuffer)
 			} else {
-				outputBuffer.WriteString(result.name)
-			}
-			if e.inodes {
-				outputBuffer.WriteString(" " + strconv.FormatUint(result.ino, 10))
-			}
-			if e.inodesHex {
-				outputBuffer.WriteString(" 0x" + strconv.FormatUint(result.ino, 16))
-			}
-			// TODO: Once adding another stat-based processor,
-			// 		 put this into interface for processing and put on outer level
-			//		 But need to make sure not to increase Result struct and do it on the fly
-			if e.withSizes {
-				fileStat, err := os.Lstat(result.name)
-				if err != nil {
-					log.Println(err)
-					outputBuffer.WriteString("0")
-				} else {
-					outputBuffer.WriteString(fmt.Sprintf(" %d", fileStat.Size()))
+				e.writeResult(result, &batchBuffer)
+				if e.chunk > 0 {
+					ends = append(ends, batchBuffer.Len())
 				}
 			}
-			// Show atime, mtime, ctime
-			if e.withTimes {
-				outputBuffer.WriteString(fmt.Sprintf(" %d %d %d", result.atime.Unix(), result.mtime.Unix(), result.ctime.Unix()))
-			}
+		}
 
-			// Delete ignore non empty dir
-			if e.delete {
-				err := os.Remove(result.name)
-				if err != nil {
-					log.Printf("Delete failed: %s - Error: %v\n", result.name, err)
-					outputBuffer.WriteString(" [delete_failed]")
-				} else {
-					log.Printf("Delete success: %s\n", result.name)
-					outputBuffer.WriteString(" [delete_success]")
-				}
+		writeLock.Lock()
+		if e.orderedOutput {
+			for nextBatch != batch {
+				writeTurn.Wait()
 			}
-
-			// Delete not ignore non empty dir
-			if e.deleteAll {
-				err := os.RemoveAll(result.name)
-				if err != nil {
-					log.Printf("Delete failed: %s - Error: %v\n", result.name, err)
-					outputBuffer.WriteString(" [delete_failed]")
-				} else {
-					log.Printf("Delete success: %s\n", result.name)
-					outputBuffer.WriteString(" [delete_success]")
+			nextBatch++
+			writeTurn.Broadcast()
+		}
+		atomic.AddInt64(&e.found, int64(len(data)))
+		chunk := batchBuffer.Bytes()
+		if e.jsonArray && len(chunk) != 0 && !arrayStarted {
+			chunk = chunk[1:]
+			arrayStarted = true
+		}
+		if e.chunk > 0 {
+			start := 0
+			for _, end := range ends {
+				if chunked != 0 && chunked%e.chunk == 0 {
+					outputBuffer.WriteString(e.recordSeparator())
 				}
+				outputBuffer.Write(chunk[start:end])
+				start = end
+				chunked++
 			}
-			outputBuffer.WriteString("\n")
-			if outputBuffer.Len() > 4*1024 {
-				flush()
+		} else {
+			outputBuffer.Write(chunk)
+		}
+		if outputBuffer.Len() > 4*1024 {
+			flush()
+		}
+		if dirsBuffer.Len() != 0 {
+			if _, err := e.dirsOutput.Write(dirsBuffer.Bytes()); err != nil {
+				e.outputFailed(err)
 			}
 		}
 		writeLock.Unlock()
@@ -349,15 +671,93 @@ func (e *Explorer) dumpResults() {
 	}
 
 	flushSlice := func(data []Result) {
+		if e.limit > 0 {
+			if taken >= e.limit {
+				releaseDirs(data)
+				return
+			}
+			if taken+int64(len(data)) >= e.limit {
+				releaseDirs(data[e.limit-taken:])
+				data = data[:e.limit-taken]
+				e.cancel(limitReachedError)
+			}
+			taken += int64(len(data))
+		}
+		if e.resultSlots != nil {
+			dirs, groups := groupByDir(data)
+			for _, dir := range dirs {
+				writeSliceLock.Add(1)
+				if !e.resultSlots.acquire(dir, groups[dir]) {
+					continue
+				}
+				_ = resultsWorkers.Acquire(ctx, 1)
+				// Job of directory keeps processing batches parked for it, if any
+				go func(dir string, data []Result) {
+					for {
+						writeData(0, data)
+						next, ok := e.resultSlots.next(dir)
+						if !ok {
+							return
+						}
+						data = next
+						_ = resultsWorkers.Acquire(ctx, 1)
+					}
+				}(dir, groups[dir])
+			}
+			return
+		}
 		writeSliceLock.Add(1)
 		_ = resultsWorkers.Acquire(ctx, 1)
-		go writeData(data)
+		go writeData(batches, data)
+		batches++
+	}
+
+	if e.uniqueInodes {
+		unique := make(uniqueResults)
+		e.drainResults(unique.add)
+		unique.flush(e.batchSize, flushSlice)
+	} else if e.seenPaths != nil {
+		e.drainResults(func(data []Result) {
+			if data = e.seenPaths.filter(data); len(data) != 0 {
+				flushSlice(data)
+			}
+		})
+	} else {
+		e.drainResults(flushSlice)
+	}
+	if e.pruneEmpty {
+		writeSliceLock.Wait()
+		e.pruneEmptyDirs()
 	}
+	if len(e.actions) != 0 {
+		writeSliceLock.Wait()
+		e.summary.log(e.actions)
+	}
+	if e.jsonArray {
+		writeSliceLock.Wait()
+		if arrayStarted {
+			outputBuffer.WriteString("\n")
+		}
+		outputBuffer.WriteString("]\n")
+	}
+	if len(e.reports) != 0 {
+		writeSliceLock.Wait()
+		// Reports go through outputBuffer too, so failure to write them is caught by flush
+		for i, r := range e.reports {
+			if i != 0 {
+				outputBuffer.WriteString("\n")
+			}
+			r.write(&outputBuffer)
+		}
+	}
+}
 
+// drainResults passes everything accumulated in resultStore to handle until all directories are done
+func (e *Explorer) drainResults(handle func(data []Result)) {
 	for {
 		if e.resultStore.length != 0 {
 			e.resultStore.Lock()
-			flushSlice(e.resultStore.store)
+			handle(e.resultStore.store)
 			e.resultStore.store = make([]Result, 0)
 			e.resultStore.length = 0
 			e.resultStore.Unlock()
@@ -375,9 +775,13 @@ func (e *Explorer) dumpResults() {
 	}
 }
 
+// requestStoreFlush wakes flushStoreLoop unless it is already woken, called with dirStore locked
 func (e *Explorer) requestStoreFlush() {
 	select {
 	case e.flushStoreRequest <- nullv:
+		if e.traceScheduler {
+			logTracef("store flush requested, %d stored", len(e.dirStore.store))
+		}
 	default:
 		return
 	}
@@ -385,9 +789,11 @@ func (e *Explorer) requestStoreFlush() {
 
 func (e *Explorer) flushStoreLoop() {
 	for {
+		trigger := "request"
 		select {
 		case <-e.flushStoreRequest:
 		case <-time.After(10 * time.Millisecond):
+			trigger = "timer"
 		}
 		e.dirStore.Lock()
 		numFlushed := 0
@@ -404,6 +810,10 @@ func (e *Explorer) flushStoreLoop() {
 				break
 			}
 		}
+		if e.traceScheduler && len(e.dirStore.store) > 0 {
+			logTracef("store flushed on %s: %d of %d stored dirs queued, %d queued, %d in flight",
+				trigger, numFlushed, len(e.dirStore.store), len(e.directories), atomic.LoadInt64(&e.inFlight))
+		}
 		if numFlushed > 0 {
 			e.dirStore.store = e.dirStore.store[:len(e.dirStore.store)-numFlushed]
 		}
@@ -418,13 +828,36 @@ func (e *Explorer) addResults(results []Result) {
 	e.resultStore.Unlock()
 }
 
+// addDir queues directory for reading, its device is looked up if needed
 func (e *Explorer) addDir(dir string) {
+	task := dirTask{path: dir, seed: filepath.Clean(dir)}
+	if e.threadsPerMount > 0 {
+		var stat syscall.Stat_t
+		if err := syscall.Stat(dir, &stat); err == nil {
+			task.dev = uint64(stat.Dev)
+		}
+	}
+	e.addTask(task)
+}
+
+func (e *Explorer) addTask(task dirTask) {
+	if e.isSkippedPath(task.path) {
+		logDebugf("Skipped by path: %s", task.path)
+		task.parent.release()
+		return
+	}
 	inFlight := atomic.AddInt64(&e.inFlight, 1)
 	select {
-	case e.directories <- dir:
+	case e.directories <- task:
+		if e.traceScheduler {
+			logTracef("queued %s, %d queued, %d in flight", task.path, len(e.directories), inFlight)
+		}
 	default:
 		e.dirStore.Lock()
-		e.dirStore.store = append(e.dirStore.store, dir)
+		e.dirStore.store = append(e.dirStore.store, task)
+		if e.traceScheduler {
+			logTracef("stored %s as queue is full, %d stored, %d in flight", task.path, len(e.dirStore.store), inFlight)
+		}
 		if inFlight-int64(len(e.dirStore.store)) < e.threads && len(e.dirStore.store) > 0 {
 			e.requestStoreFlush()
 		}
@@ -437,18 +870,47 @@ func (e *Explorer) start() {
 		e.SetThreads(1)
 	}
 	e.started = true
+	e.startTime = time.Now()
+	e.columns = e.outputColumns()
 	go e.dumpResults()
 	go e.flushStoreLoop()
 	e.rateLimiter = make(chan null, e.threads)
+	if e.statThreads > 0 {
+		e.statLimiter = make(chan null, e.statThreads)
+	}
+	if e.threadsPerMount > 0 {
+		e.mountSlots = newMountSlots(e.threadsPerMount)
+	}
 	go func() {
 		for directory := range e.directories {
 			e.rateLimiter <- nullv
-			go func(dir string) {
-				e.readdir(dir)
+			if !e.mountSlots.acquire(directory) {
+				if e.traceScheduler {
+					logTracef("parked %s until a job of its mount is free", directory.path)
+				}
 				<-e.rateLimiter
-				current := atomic.AddInt64(&e.inFlight, -1)
-				if current == 0 {
-					close(e.directories)
+				continue
+			}
+			go func(task dirTask) {
+				for {
+					e.readdir(task)
+					atomic.AddInt64(&e.dirsScanned, 1)
+					// Job keeps its slots to read directory parked for the same device, if any
+					next, ok := e.mountSlots.next(task.dev)
+					if !ok {
+						<-e.rateLimiter
+					}
+					current := atomic.AddInt64(&e.inFlight, -1)
+					if e.traceScheduler {
+						logTracef("read %s, %d in flight", task.path, current)
+					}
+					if current == 0 {
+						close(e.directories)
+					}
+					if !ok {
+						return
+					}
+					task = next
 				}
 			}(directory)
 		}
@@ -467,19 +929,95 @@ func (e *Explorer) done() controlChannel {
 	return allDone
 }
 
+// isNotIncluded tells whether path fails --filter or any of --filter-group groups.
+// Patterns within a group are alternatives, while every group has to be matched
 func (e *Explorer) isNotIncluded(path string) bool {
-	if len(e.includes) != 0 {
-		for _, include := range e.includes {
-			if include.Match(path) {
-				return false
-			}
+	path = e.matchedPath(path)
+	if len(e.includes) != 0 && !matchesAny(e.includes, path) {
+		return true
+	}
+	for _, group := range e.includeGroups {
+		if !matchesAny(group, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchedPath returns path the patterns are matched against, which is absolute with --match-absolute
+func (e *Explorer) matchedPath(path string) string {
+	if e.matchAbsolute && !filepath.IsAbs(path) {
+		return filepath.Join(e.workingDir, path)
+	}
+	return path
+}
+
+func matchesAny(patterns []glob.Glob, path string) bool {
+	for _, pattern := range patterns {
+		if pattern.Match(path) {
+			return true
 		}
+	}
+	return false
+}
+
+// matchesACL tells whether entry at path passes --has-acl and --no-acl, it is checked only if either is set
+func (e *Explorer) matchesACL(path string) bool {
+	if !e.hasACL && !e.noACL {
+		return true
+	}
+	found, err := HasACL(path)
+	if err != nil {
+		logWarnf("%v", err)
+		return false
+	}
+	return found == e.hasACL
+}
+
+// matchesStat tells whether entry passes filters by its stat: --executable and --not-executable by any execute bit
+// of its mode, --zero-blocks and --only-regular-with-data by blocks allocated to regular files.
+// Entry is statted once by name relative to dirfd following symlinks, only if any of them is set
+func (e *Explorer) matchesStat(dirfd int, name, fullpath string) bool {
+	checkMode, checkBlocks := e.executable || e.notExecutable, e.zeroBlocks || e.withData
+	if !checkMode && !checkBlocks {
 		return true
 	}
+	var stat unix.Stat_t
+	release := e.statSlot()
+	err := unix.Fstatat(dirfd, name, &stat, 0)
+	release()
+	if err != nil {
+		logWarnf("%v", &os.PathError{Op: "stat", Path: fullpath, Err: err})
+		return false
+	}
+	if checkMode && (stat.Mode&0111 != 0) != e.executable {
+		return false
+	}
+	if checkBlocks && (stat.Mode&unix.S_IFMT != unix.S_IFREG || (stat.Blocks == 0) != e.zeroBlocks) {
+		return false
+	}
+	return true
+}
+
+// isSkippedPath tells whether dir is one of --skip-path directories or located inside of them,
+// both are compared as absolute paths so relative seeds are matched against absolute skip paths and vice versa
+func (e *Explorer) isSkippedPath(dir string) bool {
+	if len(e.skipPaths) == 0 {
+		return false
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(e.workingDir, dir)
+	}
+	for _, skipped := range e.skipPaths {
+		if strings.HasPrefix(dir, skipped) && (len(dir) == len(skipped) || dir[len(skipped)] == filepath.Separator) {
+			return true
+		}
+	}
 	return false
 }
 
 func (e *Explorer) isExcluded(path string) bool {
+	path = e.matchedPath(path)
 	for _, exclude := range e.excludes {
 		if exclude.Match(path) {
 			return true
@@ -488,62 +1026,371 @@ func (e *Explorer) isExcluded(path string) bool {
 	return false
 }
 
-func (e *Explorer) readdir(dir string) {
-	if e.ctx.Err() != nil {
-		return
+// includesType tells whether entries of dirent type were requested by --type
+func (e *Explorer) includesType(direntType uint8) bool {
+	if e.includeAny {
+		return true
+	}
+	switch direntType {
+	case syscall.DT_DIR:
+		return e.includeDirs
+	case syscall.DT_REG:
+		return e.includeFiles
+	case syscall.DT_LNK:
+		return e.includeLinks
+	case syscall.DT_SOCK:
+		return e.includeSocket
+	case syscall.DT_CHR:
+		return e.includeChar
+	case syscall.DT_BLK:
+		return e.includeBlock
+	case syscall.DT_UNKNOWN:
+		return e.includeUnknown
 	}
-	file, err := OpenWithDeadline(dir, e.timeout)
+	return false
+}
+
+// resolveType stats entry of DT_UNKNOWN type relative to its directory to learn its real type. Some filesystems
+// (e.g. XFS without ftype, some NFS and overlay setups) don't fill dirent types. Type stays DT_UNKNOWN if entry can't be statted
+func (e *Explorer) resolveType(dirfd int, name, fullpath string) uint8 {
+	var stat unix.Stat_t
+	release := e.statSlot()
+	err := unix.Fstatat(dirfd, name, &stat, unix.AT_SYMLINK_NOFOLLOW)
+	release()
 	if err != nil {
-		if err == timeoutError {
-			err = errors.New(fmt.Sprintf("dir open: %s", err.Error()))
+		logWarnf("Failed to resolve type: %s %v", fullpath, err)
+		return syscall.DT_UNKNOWN
+	}
+	// Dirent types are file type bits of mode shifted, as readdir(3) defines them
+	return uint8((stat.Mode & unix.S_IFMT) >> 12)
+}
+
+// matchesNameLength tells whether name of nameLen bytes passes --name-longer and --name-shorter
+func (e *Explorer) matchesNameLength(nameLen int) bool {
+	if e.nameLonger > 0 && nameLen <= e.nameLonger {
+		return false
+	}
+	if e.nameShorter > 0 && nameLen >= e.nameShorter {
+		return false
+	}
+	return true
+}
+
+// excludeOwnFile keeps file written by the scan itself, like --output, out of results and actions.
+// Files may be added while the scan runs, like rotated outputs, so the list is replaced as a whole
+func (e *Explorer) excludeOwnFile(info os.FileInfo) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || !info.Mode().IsRegular() {
+		return
+	}
+	e.ownFilesLock.Lock()
+	defer e.ownFilesLock.Unlock()
+	var files []fileID
+	if current := e.ownFiles.Load(); current != nil {
+		files = append(files, *current...)
+	}
+	files = append(files, fileID{dev: uint64(stat.Dev), ino: uint64(stat.Ino)})
+	e.ownFiles.Store(&files)
+}
+
+// isOwnFile tells whether entry of directory is one of files set by excludeOwnFile.
+// Inode is compared first, so only entries with the same inode number are statted for their device
+func (e *Explorer) isOwnFile(dirfd int, name string, ino uint64) bool {
+	files := e.ownFiles.Load()
+	if files == nil {
+		return false
+	}
+	for _, own := range *files {
+		if own.ino != ino {
+			continue
 		}
-		if e.resilient {
-			log.Println(dir, err)
-			return
-		} else {
-			log.Fatalln(dir, err)
+		var stat unix.Stat_t
+		if err := unix.Fstatat(dirfd, name, &stat, unix.AT_SYMLINK_NOFOLLOW); err == nil && uint64(stat.Dev) == own.dev {
+			return true
 		}
 	}
-	defer file.Close()
-	fd := int(file.Fd())
+	return false
+}
 
-	buff := e.buffPool.Get().([]byte)
-	defer e.buffPool.Put(buff)
+// isSelectableType tells whether dirent type has a --type value of its own, rest are reachable only by "all"
+func isSelectableType(direntType uint8) bool {
+	switch direntType {
+	case syscall.DT_DIR, syscall.DT_REG, syscall.DT_LNK, syscall.DT_SOCK, syscall.DT_CHR, syscall.DT_BLK, syscall.DT_UNKNOWN:
+		return true
+	}
+	return false
+}
 
-	results := e.resultsPool.Get().([]Result)
-	defer e.resultsPool.Put(results)
+func (e *Explorer) isExcludedInode(ino uint64) bool {
+	if _, ok := e.excludeInodes[ino]; ok {
+		return true
+	}
+	for _, r := range e.excludeInodeRanges {
+		if ino >= r.from && ino <= r.to {
+			return true
+		}
+	}
+	return false
+}
 
-	clearResults := func() {
-		if len(results) != 0 {
-			e.addResults(results)
+// reportError reports failure to read dir, scan is aborted unless resilient
+func (e *Explorer) reportError(dir string, err error) {
+	defer e.countError()
+	if e.resilient {
+		logErrorf("%s %v", dir, err)
+		return
+	}
+	logFatalf("%s %v", dir, err)
+}
+
+// countError accounts failure of the scan, aborting it once --max-errors is reached
+func (e *Explorer) countError() {
+	if count := atomic.AddInt64(&e.errorCount, 1); count == e.maxErrors {
+		e.cancel(maxErrorsError)
+	}
+}
+
+// reportLargeDir accounts directory skipped by --skip-large-dirs
+func (e *Explorer) reportLargeDir(dir string) {
+	atomic.AddInt64(&e.largeDirsSkipped, 1)
+	logWarnf("Large directory skipped, more than %d entries: %s", e.skipLargeDirs, dir)
+}
+
+// pruneLargeDir drops subdirectories of directory with more than --max-dir-entries entries instead of descending
+// into them. Subdirectories waiting to be opened for their own times are statted to be output anyway
+func (e *Explorer) pruneLargeDir(dir string, entries int, subdirs []dirTask) {
+	if len(subdirs) == 0 {
+		return
+	}
+	atomic.AddInt64(&e.largeDirsPruned, 1)
+	logWarnf("Not descending into %d subdirectories of large directory with %d entries: %s", len(subdirs), entries, dir)
+	defer releaseParents(subdirs)
+	for _, subdir := range subdirs {
+		if subdir.self == nil {
+			continue
+		}
+		if ok, err := e.checkFileTimeConditions(unix.AT_FDCWD, subdir.path, subdir.path, subdir.self); err == nil && ok {
+			e.addSelf(*subdir.self)
 		}
-		results = results[:0]
 	}
-	defer clearResults()
+}
 
-	var name []byte
-	var fullpath string
-	var omittedByInclude bool
-	for e.ctx.Err() == nil {
-		omittedByInclude = false
-		dirlength, err := ReadDirentWithDeadline(fd, buff, e.timeout)
-		if err != nil {
-			if err == timeoutError {
-				err = errors.New(fmt.Sprintf("readdir: %s", err.Error()))
-			}
-			if e.resilient {
-				log.Println(dir, err)
-				return
-			} else {
-				log.Fatalln(dir, err)
+// reportPathTooLong reports directory which could not be opened due to its path length,
+// these are skipped without aborting the scan, as it is a limitation rather than a failure
+func (e *Explorer) reportPathTooLong(dir string) {
+	atomic.AddInt64(&e.pathsTooLong, 1)
+	logWarnf("Path too long, skipped: %s", dir)
+}
+
+// readdir reads directory of task, emitting its entries and queueing its subdirectories
+func (e *Explorer) readdir(task dirTask) {
+	dir, self := task.path, task.self
+	defer task.parent.release()
+	if e.ctx.Err() != nil {
+		return
+	}
+	if _, ok := e.archives[dir]; ok {
+		e.readArchive(dir)
+		return
+	}
+	file, err := e.openDir(dir, task.parent)
+	if err != nil {
+		if self != nil {
+			// Directory is still found even if it can't be read
+			if ok, err := e.checkFileTimeConditions(unix.AT_FDCWD, dir, dir, self); err == nil && ok {
+				e.addSelf(*self)
 			}
 		}
-		if dirlength == 0 {
-			break
+		if err == timeoutError {
+			err = errors.New(fmt.Sprintf("dir open: %s", err.Error()))
+		}
+		if errors.Is(err, syscall.ENAMETOOLONG) {
+			e.reportPathTooLong(dir)
+			return
+		}
+		if e.denied != nil && errors.Is(err, os.ErrPermission) {
+			logDebugf("Permission denied: %s", dir)
+			e.denied.add(dir)
+			e.countError()
+			return
+		}
+		e.reportError(dir, err)
+		return
+	}
+	// Paths of subdirectories might exceed PATH_MAX, then they are opened relative to this one
+	holdFile := e.unlinkAt || len(dir) >= unix.PathMax-unix.NAME_MAX-1
+	var handle *dirHandle
+	if holdFile && atomic.AddInt64(&e.heldDirs, 1) <= maxHeldDirs {
+		handle = &dirHandle{file: file, refs: 1, held: &e.heldDirs}
+		defer handle.release()
+	} else {
+		if holdFile {
+			atomic.AddInt64(&e.heldDirs, -1)
+		}
+		defer file.Close()
+	}
+	fd := int(file.Fd())
+
+	// Entries reside on the device of their directory, except for mount points which are directories themselves
+	var dev, ino uint64
+	if e.uniqueInodes || e.threadsPerMount > 0 || e.treeSummary || self != nil {
+		var stat unix.Stat_t
+		if err := unix.Fstat(fd, &stat); err != nil {
+			e.reportError(dir, err)
+			return
+		}
+		dev, ino = uint64(stat.Dev), uint64(stat.Ino)
+		// Subdirectories are queued on device of their parent, so mount points are known to be on their own one only now
+		if e.mountSlots != nil && dev != task.dev {
+			if e.traceScheduler {
+				logTracef("requeued %s on its own device", dir)
+			}
+			atomic.AddInt64(&e.dirsScanned, -1)
+			if task.parent != nil {
+				task.parent.acquire()
+			}
+			task.dev = dev
+			e.addTask(task)
+			return
+		}
+		if self != nil && !e.checkTimeConditions(time.Unix(stat.Atim.Unix()), time.Unix(stat.Mtim.Unix()), time.Unix(stat.Ctim.Unix()), self) {
+			self = nil
+		}
+	}
+	// Entries other than mount points share the filesystem of their directory, so one statfs serves all of them
+	var fstype int64
+	if e.withFstype {
+		var stat unix.Statfs_t
+		if err := unix.Fstatfs(fd, &stat); err != nil {
+			e.reportError(dir, err)
+			return
+		}
+		fstype = int64(stat.Type)
+	}
+
+	sampler := e.newSampler(dir)
+	// Entries take their seed and depth from the task, instead of a copy each
+	origin := &task
+
+	// With --tree-summary entries are only counted and directory is output once fully read
+	var summary *dirSummary
+	var complete bool
+	if e.treeSummary {
+		summary = &dirSummary{}
+		if e.summaryTypes {
+			summary.types = make(map[uint8]int64)
+		}
+	}
+
+	buff := e.buffPool.Get().([]byte)
+	// Buffer of timed out read can still be written by its syscall, so it is abandoned instead of being reused
+	var readTimedOut bool
+	defer func() {
+		if !readTimedOut {
+			e.buffPool.Put(buff)
+		}
+	}()
+
+	results := e.resultsPool.Get().([]Result)
+	defer e.putResults(results)
+
+	clearResults := func() {
+		if len(results) != 0 {
+			e.addResults(results)
+		}
+		results = results[:0]
+	}
+	defer clearResults()
+	if self != nil {
+		results = append(results, *self)
+	}
+	// Directory itself was found by its parent, so it is output even if its entries are skipped
+	selfResults := len(results)
+
+	if summary != nil {
+		defer func() {
+			if complete {
+				name := dir
+				if !strings.HasSuffix(name, string(filepath.Separator)) {
+					name += string(filepath.Separator)
+				}
+				// Directory itself is one level above its entries
+				origin := &dirTask{path: filepath.Dir(task.path), seed: task.seed, depth: task.depth - 1}
+				result := Result{name: name, ino: ino, dtype: syscall.DT_DIR, dev: dev, summary: summary, origin: origin}
+				if e.withFstype {
+					result.extra = &resultExtra{fstype: fstype}
+				}
+				results = append(results, result)
+			}
+		}()
+	}
+
+	// With --skip-large-dirs nothing is emitted until directory is known to be small enough,
+	// with --max-dir-entries only its subdirectories are held until then
+	var entries int
+	var skipped bool
+	var pendingDirs []dirTask
+	holdDirs := e.skipLargeDirs > 0 || e.maxDirEntries > 0
+	if holdDirs {
+		defer func() {
+			if skipped {
+				releaseDirs(results[selfResults:])
+				results = results[:selfResults]
+				releaseParents(pendingDirs)
+				return
+			}
+			if e.maxDirEntries > 0 && entries > e.maxDirEntries {
+				e.pruneLargeDir(dir, entries, pendingDirs)
+				return
+			}
+			for _, pending := range pendingDirs {
+				e.addTask(pending)
+			}
+		}()
+	}
+
+	queueDir := func(task dirTask) {
+		if holdDirs {
+			pendingDirs = append(pendingDirs, task)
+		} else {
+			e.addTask(task)
+		}
+	}
+	// heldDir is subdirectory of the current entry, queued once it is known whether it waits for its own times
+	var heldDir *dirTask
+	releaseHeldDir := func() {
+		if heldDir != nil {
+			queueDir(*heldDir)
+			heldDir = nil
+		}
+	}
+	defer releaseHeldDir()
+
+	var name []byte
+	var fullpath string
+	var omittedByInclude bool
+	// Number of entries of the directory output so far, to stop at --per-dir-limit
+	var emitted int
+	for e.ctx.Err() == nil {
+		releaseHeldDir()
+		omittedByInclude = false
+		dirlength, err := e.readDirent(dir, fd, buff)
+		if err != nil {
+			if err == timeoutError {
+				readTimedOut = true
+				err = errors.New(fmt.Sprintf("readdir: %s", err.Error()))
+			}
+			e.reportError(dir, err)
+			return
+		}
+		if dirlength == 0 {
+			complete = true
+			break
 		}
 		var offset uint64
 	MAINLOOP:
 		for offset = 0; offset < uint64(dirlength); {
+			releaseHeldDir()
 			dirent := (*syscall.Dirent)(unsafe.Pointer(&buff[offset]))
 
 			for i, c := range buff[offset+direntNameOffset:] {
@@ -560,136 +1407,296 @@ func (e *Explorer) readdir(dir string) {
 			} else if nameLen == 2 && name[0] == '.' && name[1] == '.' {
 				continue
 			}
+			entries++
+			if e.skipLargeDirs > 0 && entries > e.skipLargeDirs {
+				skipped = true
+				e.reportLargeDir(dir)
+				return
+			}
 
 			fullpath = filepath.Join(dir, string(name))
 
-			isDir := dirent.Type == syscall.DT_DIR
+			// Unknown type has to be resolved before anything else, as it decides whether to descend
+			direntType := dirent.Type
+			if direntType == syscall.DT_UNKNOWN {
+				direntType = e.resolveType(fd, string(name), fullpath)
+			}
+			isDir := direntType == syscall.DT_DIR
 			omittedByInclude = e.isNotIncluded(fullpath)
 			if omittedByInclude && !isDir {
 				continue MAINLOOP
 			}
 			if e.isExcluded(fullpath) {
+				logDebugf("Excluded by pattern: %s", fullpath)
 				continue MAINLOOP
 			}
-			if isDir {
-				e.addDir(fullpath)
+			if e.isExcludedInode(GetIno(dirent)) {
+				logDebugf("Excluded by inode: %s iNode<%d>", fullpath, GetIno(dirent))
+				continue MAINLOOP
 			}
-
-			if omittedByInclude {
+			if e.isOwnFile(fd, string(name), GetIno(dirent)) {
+				logDebugf("Excluded own output: %s", fullpath)
 				continue MAINLOOP
 			}
-
-			switch dirent.Type {
-			case syscall.DT_DIR:
-				if e.includeDirs || e.includeAny {
-					if e.atimeOlderThan != 0 || e.atimeNewerThan != 0 || e.ctimeOlderThan != 0 || e.ctimeNewerThan != 0 || e.mtimeOlderThan != 0 || e.mtimeNewerThan != 0 || e.withTimes {
-						// Check times and get the Result struct
-						result, ok, err := e.checkFileTimeConditions(fullpath)
-						if err != nil || !ok {
-							continue
-						}
-						results = append(results, result)
-					} else {
-						results = append(results, Result{fullpath + string(filepath.Separator), GetIno(dirent), time.Time{}, time.Time{}, time.Time{}})
-					}
+			if isDir && e.skipHiddenDirs && name[0] == '.' {
+				logDebugf("Not descending into hidden directory: %s", fullpath)
+			} else if isDir {
+				task := dirTask{path: fullpath, dev: dev, seed: task.seed, depth: task.depth + 1}
+				if handle != nil && len(fullpath) >= unix.PathMax {
+					handle.acquire()
+					task.parent = handle
 				}
-			case syscall.DT_REG:
-				if e.includeFiles || e.includeAny {
-					if e.atimeOlderThan != 0 || e.atimeNewerThan != 0 || e.ctimeOlderThan != 0 || e.ctimeNewerThan != 0 || e.mtimeOlderThan != 0 || e.mtimeNewerThan != 0 || e.withTimes {
-						// Check times and get the Result struct
-						result, ok, err := e.checkFileTimeConditions(fullpath)
-						if err != nil || !ok {
-							continue
-						}
-						results = append(results, result)
-					} else {
-						results = append(results, Result{fullpath, GetIno(dirent), time.Time{}, time.Time{}, time.Time{}})
-					}
+				// Times of directory which is going to be opened anyway are taken from fstat then, saving a stat here
+				if e.needsTimes() && summary == nil && !e.isSkippedPath(fullpath) {
+					heldDir = &task
+				} else {
+					queueDir(task)
 				}
-			case syscall.DT_LNK:
-				if e.includeLinks || e.includeAny {
-					if e.atimeOlderThan != 0 || e.atimeNewerThan != 0 || e.ctimeOlderThan != 0 || e.ctimeNewerThan != 0 || e.mtimeOlderThan != 0 || e.mtimeNewerThan != 0 || e.withTimes {
-						// Check times and get the Result struct
-						result, ok, err := e.checkFileTimeConditions(fullpath)
-						if err != nil || !ok {
-							continue
-						}
-						results = append(results, result)
-					} else {
-						results = append(results, Result{fullpath, GetIno(dirent), time.Time{}, time.Time{}, time.Time{}})
-					}
+			}
+
+			if omittedByInclude || e.perDirLimit > 0 && emitted >= e.perDirLimit {
+				continue MAINLOOP
+			}
+
+			if !e.includesType(direntType) {
+				if !isSelectableType(direntType) {
+					logInfof("Skipped record: %s iNode<%d>[type:%s]", fullpath, GetIno(dirent), entryType(direntType))
 				}
-			case syscall.DT_SOCK:
-				if e.includeSocket || e.includeAny {
-					if e.atimeOlderThan != 0 || e.atimeNewerThan != 0 || e.ctimeOlderThan != 0 || e.ctimeNewerThan != 0 || e.mtimeOlderThan != 0 || e.mtimeNewerThan != 0 || e.withTimes {
-						// Check times and get the Result struct
-						result, ok, err := e.checkFileTimeConditions(fullpath)
-						if err != nil || !ok {
-							continue
-						}
-						results = append(results, result)
-					} else {
-						results = append(results, Result{fullpath, GetIno(dirent), time.Time{}, time.Time{}, time.Time{}})
-					}
+				continue MAINLOOP
+			}
+			if !e.matchesNameLength(nameLen) || e.nonNFC && norm.NFC.IsNormal(name) {
+				continue MAINLOOP
+			}
+			result := Result{name: fullpath, ino: GetIno(dirent), dtype: direntType, dev: dev, origin: origin}
+			if e.withFstype || e.withDirent {
+				result.extra = &resultExtra{fstype: fstype, reclen: dirent.Reclen, direntType: dirent.Type}
+			}
+			if isDir {
+				result.name += string(filepath.Separator)
+			}
+			if e.needsTimes() && heldDir == nil {
+				statDir, statName := unix.AT_FDCWD, fullpath
+				if e.readdirplus {
+					statDir, statName = fd, string(name)
 				}
-			default:
-				if e.includeAny {
-					if e.atimeOlderThan != 0 || e.atimeNewerThan != 0 || e.ctimeOlderThan != 0 || e.ctimeNewerThan != 0 || e.mtimeOlderThan != 0 || e.mtimeNewerThan != 0 || e.withTimes {
-						// Check times and get the Result struct
-						result, ok, err := e.checkFileTimeConditions(fullpath)
-						if err != nil || !ok {
-							continue
-						}
-						results = append(results, result)
-					} else {
-						results = append(results, Result{fullpath, GetIno(dirent), time.Time{}, time.Time{}, time.Time{}})
-					}
-				} else {
-					log.Printf("Skipped record: %s iNode<%d>[type:%s]\n", fullpath, GetIno(dirent), entryType(dirent.Type))
+				if ok, err := e.checkFileTimeConditions(statDir, statName, fullpath, &result); err != nil || !ok {
+					continue MAINLOOP
 				}
 			}
-			if len(results) == 1024 {
+			if !e.matchesACL(fullpath) || !e.matchesStat(fd, string(name), fullpath) {
+				continue MAINLOOP
+			}
+			if sampler != nil && sampler.Float64() >= e.sampleRate {
+				continue MAINLOOP
+			}
+			if e.state != nil && !e.changedAt(fd, string(name), fullpath) {
+				continue MAINLOOP
+			}
+			if summary != nil {
+				e.countEntry(summary, fd, string(name), fullpath, direntType)
+				continue MAINLOOP
+			}
+			emitted++
+			if heldDir != nil {
+				heldDir.self = &result
+				continue MAINLOOP
+			}
+			if e.unlinkAt && handle != nil && !isDir {
+				handle.acquire()
+				result.dir = handle
+			}
+			results = append(results, result)
+			if len(results) == e.batchSize && e.skipLargeDirs == 0 {
 				clearResults()
 			}
 		}
 	}
 }
 
+// addSelf emits result of directory which was waiting for its times
+func (e *Explorer) addSelf(result Result) {
+	e.addResults([]Result{result})
+}
+
+// countEntry accounts entry of directory into its --tree-summary, files are statted relative to directory fd for their size
+func (e *Explorer) countEntry(summary *dirSummary, dirfd int, name, fullpath string, direntType uint8) {
+	if summary.types != nil {
+		summary.types[direntType]++
+	}
+	if direntType == syscall.DT_DIR {
+		summary.dirs++
+		return
+	}
+	summary.files++
+	var stat unix.Stat_t
+	release := e.statSlot()
+	err := unix.Fstatat(dirfd, name, &stat, unix.AT_SYMLINK_NOFOLLOW)
+	release()
+	if err != nil {
+		logWarnf("%s %v", fullpath, err)
+		return
+	}
+	summary.size += stat.Size
+}
+
 type Options struct {
-	Resilient      bool          `long:"resilient" description:"DEPRECATED and ignored, resilient is a default, use --stop-on-error if it is undesired behaviour"`
-	StopOnError    bool          `long:"stop-on-error" description:"Aborts scan on any error"`
-	Inodes         bool          `long:"inodes" description:"Output inodes (decimal) along with filenames"`
-	InodesHex      bool          `long:"inodes-hex" description:"Output inodes (hexadecimal) along with filenames"`
-	Raw            bool          `long:"raw" description:"Output filenames as escaped strings"`
-	Threads        int           `short:"j" long:"jobs" description:"Number of jobs(threads)" default:"128"`
-	WithSizes      bool          `long:"with-size" description:"Output file sizes along with filenames"`
-	WithTimes      bool          `long:"with-times" description:"Output file with atime, mtime, ctime along with filenames"`
-	AtimeOlderThan time.Duration `long:"atime-older" description:"Filter files by access time older than this duration (e.g., 24h5m25s)" default:"0s"`
-	AtimeNewerThan time.Duration `long:"atime-newer" description:"Filter files by access time newer than this duration (e.g., 24h5m25s)" default:"0s"`
-	MtimeOlderThan time.Duration `long:"mtime-older" description:"Filter files by modification time older than this duration (e.g., 24h5m25s)" default:"0s"`
-	MtimeNewerThan time.Duration `long:"mtime-newer" description:"Filter files by modification time newer than this duration (e.g., 24h5m25s)" default:"0s"`
-	CtimeOlderThan time.Duration `long:"ctime-older" description:"Filter files by change time older than this duration (e.g., 24h5m25s)" default:"0s"`
-	CtimeNewerThan time.Duration `long:"ctime-newer" description:"Filter files by change time newer than this duration (e.g., 24h5m25s)" default:"0s"`
-	ResultThreads  int           `long:"result-jobs" description:"Number of jobs for processing results, like doing stats to get file sizes" default:"128"`
-	Delete         bool          `long:"delete" description:"Delete found files. Non empty directories will be ignored"`
-	DeleteAll      bool          `long:"delete-all" description:"Delete found files. Non empty directories will be removed with ALL their contents!!!"`
-	Version        bool          `short:"v" long:"version" description:"Show version"`
-
-	Exclude []string `short:"x" long:"exclude" description:"Patterns to exclude. Can be specified multiple times"`
-	Filter  []string `short:"f" long:"filter" description:"Patterns to filter by. Can be specified multiple times"`
-
-	Type []string `short:"t" long:"type" default:"file" default:"dir" default:"link" default:"socket" description:"Search entries of specific type \nPossible values: file, dir, link, socket, all. Can be specified multiple times"`
+	Config          string     `long:"config" no-ini:"yes" description:"Read default options from this INI file, as long option names under [Application Options] (e.g., jobs = 64). Options given on the command line override them. Flags enabled in the file can't be disabled, so actions are not accepted in it"`
+	Resilient       bool       `long:"resilient" description:"DEPRECATED and ignored, resilient is a default, use --stop-on-error if it is undesired behaviour"`
+	StopOnError     bool       `long:"stop-on-error" description:"Aborts scan on any error"`
+	StatusJSON      bool       `long:"status-json" description:"Print a JSON object with totals, duration and exit reason to stderr when the scan ends. See README for the schema"`
+	MaxErrors       int64      `long:"max-errors" description:"Aborts scan once this many errors are reported, keeping results found so far"`
+	Inodes          bool       `long:"inodes" description:"Output inodes (decimal) along with filenames"`
+	InodesHex       bool       `long:"inodes-hex" description:"Output inodes (hexadecimal) along with filenames"`
+	InodesOnly      bool       `long:"inodes-only" description:"Output only inodes, without filenames. Decimal unless --inodes-hex is set"`
+	Columns         string     `long:"columns" description:"Comma separated attributes to output, in this order. Replaces --inodes, --inodes-hex, --with-size, --with-times, --with-fstype, --with-rdev, --with-scan-time, --with-dirent, --with-seed, --with-depth and --with-mode\nPossible values: path, inode, inode-hex, size, atime, mtime, ctime, fstype, rdev, scantime, dirent, seed, depth, abspath, relpath, mode"`
+	Raw             bool       `long:"raw" description:"Output filenames as escaped strings"`
+	QuoteWhenNeeded bool       `long:"quote-when-needed" description:"Output filenames as escaped strings only if they contain spaces, control or non-printable characters"`
+	JSON            bool       `long:"json" description:"Output results as JSON objects, one per line. See README for the schema"`
+	JSONArray       bool       `long:"json-array" description:"Output results as a single JSON array of the same objects as --json, streamed as they are found"`
+	Prefix          string     `long:"prefix" description:"Prepend this string to every output line, e.g. 'rm -f ' to generate a script. Names are not shell escaped"`
+	Suffix          string     `long:"suffix" description:"Append this string to every output line"`
+	Print0          bool       `short:"0" long:"print0" description:"Terminate output lines with NUL instead of newline, so any filename is unambiguous"`
+	State           string     `long:"state" description:"Output only entries new or changed in mtime or size since the scan which saved this file, and save the entries found to it once the scan is complete. Paths of entries of both the previous and the current scan are kept in memory"`
+	ReportDenied    bool       `long:"report-denied" description:"Instead of an error per directory which can't be read for lack of permissions, list them all to stderr once the scan ends, sorted"`
+	DeniedTo        string     `long:"denied-to" description:"Write directories which can't be read for lack of permissions to this file once the scan ends, one per line. Implies --report-denied"`
+	DirsTo          string     `long:"dirs-to" description:"Write directory results to this file, separately from the rest of results. Compressed the same as output"`
+	Output          string     `short:"o" long:"output" description:"Write results to file instead of stdout. The file, same as stdout redirected to a file, is never found by the scan itself"`
+	OutputRotate    ByteSize   `long:"output-rotate" description:"Write results to files named after --output with scan start time and sequence number (e.g., scan-20240514T103626-0001.txt), starting the next one after this size (e.g., 1G) before compression"`
+	Gzip            bool       `long:"gzip" description:"Compress output with gzip"`
+	Zstd            bool       `long:"zstd" description:"Compress output with zstd"`
+	Threads         int        `short:"j" long:"jobs" description:"Number of jobs(threads)" default:"128"`
+	WithSizes       bool       `long:"with-size" description:"Output file sizes along with filenames"`
+	WithFstype      bool       `long:"with-fstype" description:"Output type of filesystem (e.g., ext4, xfs, nfs) along with filenames"`
+	WithRdev        bool       `long:"with-rdev" description:"Output major:minor device numbers of char and block devices along with filenames"`
+	WithMode        bool       `long:"with-mode" description:"Output type and permission bits like ls -l does (e.g., -rwxr-xr-x) along with filenames"`
+	WithSeed        bool       `long:"with-seed" description:"Output the searched directory each entry was found under"`
+	WithDepth       bool       `long:"with-depth" description:"Output depth of each entry below the searched directory, 1 for its direct entries"`
+	WithDirent      bool       `long:"with-dirent" description:"Output raw dirent record length and type byte as reclen:type, for filesystem tooling. Type is as read, 0 where filesystem doesn't fill it. Entries not read from a directory print -"`
+	WithScanTime    bool       `long:"with-scan-time" description:"Output time each entry was output at, shortly after it was found, with microseconds, to correlate slow parts of the tree with log and --stats"`
+	WithTimes       bool       `long:"with-times" description:"Output file with atime, mtime, ctime along with filenames"`
+	AtimeOlderThan  TimeFilter `long:"atime-older" description:"Filter files by access time older than this age (e.g., 24h5m25s, 30d), or only entries of a type as type:age (e.g., dir:365d). Can be specified multiple times"`
+	AtimeNewerThan  TimeFilter `long:"atime-newer" description:"Filter files by access time newer than this age (e.g., 24h5m25s, 30d), or only entries of a type as type:age (e.g., dir:365d). Can be specified multiple times"`
+	MtimeOlderThan  TimeFilter `long:"mtime-older" description:"Filter files by modification time older than this age (e.g., 24h5m25s, 30d), or only entries of a type as type:age (e.g., dir:365d). Can be specified multiple times"`
+	MtimeNewerThan  TimeFilter `long:"mtime-newer" description:"Filter files by modification time newer than this age (e.g., 24h5m25s, 30d), or only entries of a type as type:age (e.g., dir:365d). Can be specified multiple times"`
+	CtimeOlderThan  TimeFilter `long:"ctime-older" description:"Filter files by change time older than this age (e.g., 24h5m25s, 30d), or only entries of a type as type:age (e.g., dir:365d). Can be specified multiple times"`
+	CtimeNewerThan  TimeFilter `long:"ctime-newer" description:"Filter files by change time newer than this age (e.g., 24h5m25s, 30d), or only entries of a type as type:age (e.g., dir:365d). Can be specified multiple times"`
+	ChangedWithin   TimeFilter `long:"changed-within" description:"Filter files by any of access, modification or change time newer than this age (e.g., 1h), or only entries of a type as type:age (e.g., dir:1h). Can be specified multiple times"`
+	Future          bool       `long:"future" description:"Filter files with modification or change time in the future, written by a machine with a wrong clock. With --with-times the ones in the future are listed as [future:mtime,ctime]"`
+	FailIfEmpty     bool       `long:"fail-if-empty" description:"Exit with code 3 if nothing was found, for alerting on missing files"`
+	FailIfFound     bool       `long:"fail-if-found" description:"Exit with code 3 if anything was found, for asserting no such files exist. Combine with --limit 1 to stop at first match"`
+	Limit           int64      `long:"limit" description:"Stop the scan after this many results"`
+	PerDirLimit     int        `long:"per-dir-limit" description:"Output at most this many matching entries of each directory, for a sample spread across the tree unlike --limit. Subdirectories are still searched"`
+	Chunk           int        `long:"chunk" description:"Separate every this many results with an empty line, or an empty record with --print0, for downstream processing in batches"`
+	MaxBytes        ByteSize   `long:"max-bytes" description:"Stop the scan once total size of results reaches this size (e.g., 10G). Requires --with-size or size in --columns"`
+	Readdirplus     bool       `long:"readdirplus" description:"Stat entries relative to their open directory right after reading it, letting NFS client serve them from READDIRPLUS attributes instead of a lookup per path"`
+	StatThreads     int        `long:"stat-jobs" description:"Number of concurrent stats done for filters and outputs requiring them. Same as --jobs if not set"`
+	SkipLargeDirs   int        `long:"skip-large-dirs" description:"Skip directories with more than this many entries, neither outputting nor descending into them"`
+	MaxDirEntries   int        `long:"max-dir-entries" description:"Don't descend into subdirectories of directories with more than this many entries, still outputting their direct entries. Pruned directories are reported"`
+	BatchSize       int        `long:"batch-size" default:"1024" description:"Number of entries passed from directory readers to results processing at once. Larger batches reduce lock contention, smaller give more responsive output"`
+	TraceScheduler  bool       `long:"trace-scheduler" description:"Log when directories are queued, stored for later, flushed from the store and read, with queue counts, to diagnose stalled or growing scans. Very verbose"`
+	LowMemory       bool       `long:"low-memory" description:"Read directories with smaller buffers and don't pool batches of results, lowering peak memory in small containers at the cost of throughput"`
+	ThreadsPerMount int        `long:"threads-per-mount" description:"Maximum number of jobs reading directories of the same device, so slow mounts can't starve fast ones. Not limited if not set"`
+	ResultThreads   int        `long:"result-jobs" description:"Number of jobs for processing results, like doing stats to get file sizes" default:"128"`
+	ResultsPerDir   int        `long:"result-jobs-per-dir" description:"Number of result jobs processing entries of the same directory at once, so a huge directory doesn't starve the others"`
+	OrderedOutput   bool       `long:"ordered-output" description:"Write result batches in the order they were found, results are still processed in parallel"`
+	UniqueInodes    bool       `long:"unique-inodes" description:"Output each file once, even if it has multiple hard links, choosing the shortest path. Results are held until the scan is complete"`
+	DedupPaths      bool       `long:"dedup-paths" description:"Output each path once, e.g. if entries are moved around during the scan. Keeps all output paths in memory"`
+	Delete          bool       `long:"delete" no-ini:"yes" description:"Delete found files. Non empty directories will be ignored"`
+	DeleteAll       bool       `long:"delete-all" no-ini:"yes" description:"Delete found files. Non empty directories will be removed with ALL their contents!!!"`
+	PruneEmpty      bool       `long:"prune-empty" no-ini:"yes" description:"Remove directories left empty after deleting or moving found files, up to the searched directories"`
+	Shred           bool       `long:"shred" no-ini:"yes" description:"Overwrite content of deleted files with random data before removing them. Ineffective on copy-on-write filesystems and SSDs"`
+	ShredPasses     int        `long:"shred-passes" default:"3" description:"Number of times --shred overwrites content of files"`
+	MoveTo          string     `long:"move-to" no-ini:"yes" description:"Move found files into this directory, preserving their path relative to the searched directory"`
+	CopyTo          string     `long:"copy-to" no-ini:"yes" description:"Copy found files into this directory, preserving their path relative to the searched directory, permissions and modification time"`
+	Chmod           string     `long:"chmod" no-ini:"yes" description:"Set permissions of found entries to this octal mode (e.g., 0644)"`
+	Chown           string     `long:"chown" no-ini:"yes" description:"Set owner of found entries, in form user:group, user or :group. Names and numeric ids are accepted"`
+	Touch           bool       `long:"touch" no-ini:"yes" description:"Set access and modification times of found entries to current time"`
+	TouchRef        string     `long:"touch-ref" no-ini:"yes" description:"Set access and modification times of found entries to the ones of this file"`
+	DryRun          bool       `long:"dry-run" description:"Report what delete, move, copy, chmod, chown and touch would do, without changing anything"`
+	MaxReadSize     ByteSize   `long:"max-read-size" description:"Skip files larger than this size (e.g., 512M) in actions reading file content, like copying"`
+	OnCollision     string     `long:"on-collision" default:"error" choice:"error" choice:"suffix" choice:"overwrite" description:"What to do when moved or copied file already exists in destination"`
+	LogLevel        string     `long:"log-level" default:"info" description:"Minimal level of logged messages\nPossible values: debug, info, warn, error"`
+	Quiet           bool       `short:"q" long:"quiet" description:"Log failures only and omit success markers of actions from results, which --log-level=warn alone keeps"`
+	Verbose         bool       `long:"verbose" description:"Log additional diagnostics, like entries dropped by excludes. Same as --log-level=debug"`
+	Version         bool       `short:"v" long:"version" description:"Show version"`
+
+	Exclude        []string `short:"x" long:"exclude" description:"Patterns to exclude. Can be specified multiple times"`
+	Filter         []string `short:"f" long:"filter" description:"Patterns to filter by. Can be specified multiple times"`
+	MatchAbsolute  bool     `long:"match-absolute" description:"Match --exclude, --filter and --filter-group patterns against absolute paths, even when searched directories are relative"`
+	FilterGroup    []string `long:"filter-group" description:"Pattern of a named group as name:pattern (e.g., ext:*.log). Entries have to match any pattern of every group, and --filter if set. Can be specified multiple times"`
+	NameLonger     int      `long:"name-longer" description:"Find only entries with names longer than this many bytes"`
+	NameShorter    int      `long:"name-shorter" description:"Find only entries with names shorter than this many bytes"`
+	Executable     bool     `long:"executable" description:"Find only entries with any execute bit set, following symlinks. Combine with -t file to find scripts and binaries"`
+	NotExecutable  bool     `long:"not-executable" description:"Find only entries without any execute bit set, following symlinks"`
+	ZeroBlocks     bool     `long:"zero-blocks" description:"Find only regular files without allocated blocks, like sparse files never written to or with data inlined into metadata, following symlinks"`
+	WithData       bool     `long:"only-regular-with-data" description:"Find only regular files with allocated blocks, following symlinks"`
+	HasACL         bool     `long:"has-acl" description:"Find only entries with POSIX access or default ACL, which mode bits don't tell about"`
+	NoACL          bool     `long:"no-acl" description:"Find only entries without POSIX ACL"`
+	NonNFC         bool     `long:"non-nfc" description:"Find only entries with names not in Unicode NFC form, e.g. decomposed names created on macOS"`
+	SkipPath       []string `long:"skip-path" description:"Directory not to descend into, along with everything under it (e.g., /proc). Cheaper than --exclude patterns. Can be specified multiple times"`
+	SkipHiddenDirs bool     `long:"skip-hidden-dirs" description:"Don't descend into directories with names starting with a dot (e.g., .git, .cache). They and hidden files are still output"`
+	DeletedOpen    bool     `long:"deleted-open" description:"Instead of searching directories, list deleted files still held open by processes, as path, pid, fd and size, largest first"`
+	RelativeTo     string   `long:"relative-to" description:"Output paths relative to this directory, paths outside of it are printed as absolute"`
+	RealPath       bool     `long:"realpath" description:"Output canonical absolute paths with all symlinks resolved. Costs extra stats per result, entries failing to resolve (e.g., dangling links) are output as found"`
+	AllowFileSeeds bool     `long:"allow-file-seeds" description:"Accept files among directories to search, outputting them as found entries subject to the same filters. Otherwise they are skipped with a warning"`
+	StripPrefix    string   `long:"strip-prefix" description:"Remove this string from the beginning of output paths having it, only where it ends at a path component (e.g., /mnt/snapshot)"`
+	AddPrefix      string   `long:"add-prefix" description:"Prepend this string to output paths, after --strip-prefix"`
+	IncludeRoot    bool     `long:"include-root" description:"Output searched directories themselves, subject to the same filters as found entries"`
+	TreeSummary    bool     `long:"tree-summary" description:"Output a line per scanned directory with count of its files, subdirectories and total size of files, instead of listing entries. Not recursive, filters apply to counted entries"`
+	DirReportJSON  bool     `long:"dir-report-json" description:"Output a JSON object per scanned directory as it completes, with counts of its entries per type and total size of files, for dashboards. Implies --tree-summary and --json"`
+
+	SizeHistogram bool   `long:"size-histogram" description:"Print count and total size of found entries per size bucket instead of listing them"`
+	SizeBuckets   string `long:"size-buckets" description:"Comma separated bounds of --size-histogram buckets (e.g., 4K,1M,1G). Powers of two if not set"`
+	AgeHistogram  bool   `long:"age-histogram" description:"Print count and total size of found entries per modification time age bucket instead of listing them"`
+	AgeBuckets    string `long:"age-buckets" default:"1d,7d,30d,90d,365d" description:"Comma separated bounds of --age-histogram buckets, days or durations"`
+	CountByType   bool   `long:"count-by-type" description:"Print count of found entries per type instead of listing them, without statting them"`
+	ExtStats      bool   `long:"ext-stats" description:"Print count and total size of found files per extension, largest first, instead of listing them"`
+	Top           int    `long:"top" description:"Limit --ext-stats to this many largest extensions"`
+	Tree          bool   `long:"tree" description:"Print found entries indented under their directories like tree(1) instead of listing them. All results are held in memory until the scan is complete"`
+	Estimate      bool   `long:"estimate" description:"Print count of found entries and their total size extrapolated from a sample, instead of listing them. Actions and --prune-empty are not applied, to plan them"`
+
+	Sample float64 `long:"sample" default:"1" description:"Output each matched entry with this probability (e.g., 0.001), for fast approximate statistics"`
+	Seed   uint64  `long:"seed" description:"Seed for --sample, the same seed samples the same entries. Random if not set"`
+
+	ExcludeInodes      []uint64 `long:"exclude-inode" description:"Inode to exclude. Can be specified multiple times"`
+	ExcludeInodeRanges []string `long:"exclude-inode-range" description:"Inclusive range of inodes to exclude (e.g., 100-200). Can be specified multiple times"`
+
+	Type []string `short:"t" long:"type" default:"file" default:"dir" default:"link" default:"socket" description:"Search entries of specific type \nPossible values: file, dir, link, socket, char, block, unknown, all. Unknown are entries which type couldn't be learned even by stat. Can be specified multiple times or as comma separated list"`
 
 	Args struct {
-		Directories []string `positional-arg-name:"directories" description:"Directories to search, using current directory if missing"`
+		Directories []string `positional-arg-name:"directories" description:"Directories to search, using current directory if missing. Archives (.tar, .tar.gz, .tgz, .tar.zst, .zip) are searched as directories of their members"`
 	} `positional-args:"yes"`
+	Seeds0 string `long:"seeds0" description:"Read NUL separated directories to search from this file, or stdin if -, in addition to the ones given as arguments (e.g., from find -print0)"`
+
+	Retries    int           `long:"retries" description:"Retry opening and reading directories this many times on transient errors (ESTALE, EAGAIN, EIO), with exponential backoff from 100ms"`
+	Timeout    time.Duration `long:"timeout" default:"5m" description:"Timeout for readdir operations. Error will be reported, but os thread will be kept hanging"`
+	MaxRuntime time.Duration `long:"max-runtime" description:"Stop the whole scan after this duration, keeping results found so far. Exits with code 124"`
+	Progress   time.Duration `long:"progress" description:"Log scan counters with rate of scanned directories and estimated remaining time at this interval (e.g., 30s)"`
 
-	Timeout time.Duration `long:"timeout" default:"5m" description:"Timeout for readdir operations. Error will be reported, but os thread will be kept hanging"`
+	PprofAddr string `long:"pprof-addr" description:"Serve net/http/pprof profiles on this address (e.g., localhost:6060) during the scan"`
+}
+
+// readConfig sets options of INI config file as defaults of parser. Actions are marked no-ini and rejected
+// as unknown options, since flags enabled in the file can't be disabled on the command line
+func readConfig(parser *flags.Parser, config string) error {
+	iniParser := flags.NewIniParser(parser)
+	iniParser.ParseAsDefaults = true
+	return iniParser.ParseFile(ExpandHomePath(config))
 }
 
 func getOpts() *Options {
 	opts := &Options{}
 	_, err := flags.Parse(opts)
+	if err == nil && opts.Config != "" {
+		// Values of config file are defaults, so options are parsed again for the command line to override them
+		config := opts.Config
+		opts = &Options{}
+		parser := flags.NewParser(opts, flags.Default)
+		if err := readConfig(parser, config); err != nil {
+			logFatalf("--config: %v", err)
+		}
+		_, err = parser.Parse()
+	}
 	if opts.Version {
 		fmt.Printf("%s version %s\n", path.Base(os.Args[0]), Version)
 		os.Exit(0)
@@ -698,20 +1705,254 @@ func getOpts() *Options {
 		if flagsErr.Type == flags.ErrHelp {
 			os.Exit(0)
 		}
-		log.Fatalln(flagsErr)
-		os.Exit(1)
+		logFatalf("%v", flagsErr)
 	}
 
 	if err != nil {
-		log.Fatalln(err.Error())
+		logFatalf("%v", err)
+	}
+
+	if opts.DirReportJSON {
+		opts.TreeSummary = true
+		opts.JSON = !opts.JSONArray
+	}
+
+	if err := opts.validate(); err != nil {
+		logFatalf("%v", err)
 	}
 
-	if len(opts.Args.Directories) == 0 {
+	if opts.Seeds0 != "" {
+		seeds, err := ReadSeeds0(opts.Seeds0)
+		if err != nil {
+			logFatalf("--seeds0: %v", err)
+		}
+		opts.Args.Directories = append(opts.Args.Directories, seeds...)
+	} else if len(opts.Args.Directories) == 0 {
 		opts.Args.Directories = []string{"."}
 	}
 	return opts
 }
 
+// validate rejects option combinations which can't be satisfied or would silently misbehave
+func (opts *Options) validate() error {
+	if opts.Delete && opts.DeleteAll {
+		return errors.New("--delete and --delete-all are mutually exclusive")
+	}
+	if opts.Gzip && opts.Zstd {
+		return errors.New("--gzip and --zstd are mutually exclusive")
+	}
+	if opts.MoveTo != "" && (opts.Delete || opts.DeleteAll) {
+		return errors.New("--move-to can't be combined with --delete or --delete-all")
+	}
+	if opts.CopyTo != "" && (opts.Delete || opts.DeleteAll || opts.MoveTo != "") {
+		return errors.New("--copy-to can't be combined with --delete, --delete-all or --move-to, use --move-to instead")
+	}
+	if (opts.Delete || opts.DeleteAll || opts.MoveTo != "" || opts.CopyTo != "") && (opts.Chmod != "" || opts.Chown != "" || opts.Touch || opts.TouchRef != "") {
+		return errors.New("--chmod, --chown, --touch and --touch-ref can't be combined with --delete, --delete-all, --move-to or --copy-to")
+	}
+	if opts.Touch && opts.TouchRef != "" {
+		return errors.New("--touch and --touch-ref are mutually exclusive")
+	}
+	if opts.Shred && !opts.Delete {
+		return errors.New("--shred requires --delete, contents of directories removed by --delete-all wouldn't be shredded")
+	}
+	if opts.ShredPasses < 1 {
+		return errors.New("--shred-passes must be at least 1")
+	}
+	if opts.PruneEmpty && !opts.Delete && !opts.DeleteAll && opts.MoveTo == "" {
+		return errors.New("--prune-empty requires --delete, --delete-all or --move-to")
+	}
+	if (opts.JSON || opts.JSONArray) && (opts.Raw || opts.QuoteWhenNeeded || opts.Print0) {
+		return errors.New("--json and --json-array can't be combined with --raw, --quote-when-needed or --print0, JSON strings are always escaped")
+	}
+	if (opts.Prefix != "" || opts.Suffix != "") && (opts.JSON || opts.JSONArray || opts.Print0) {
+		return errors.New("--prefix and --suffix can't be combined with --json, --json-array or --print0")
+	}
+	for _, value := range opts.FilterGroup {
+		if name, _, ok := strings.Cut(value, ":"); !ok || name == "" {
+			return fmt.Errorf("--filter-group %q must be name:pattern", value)
+		}
+	}
+	if opts.Executable && opts.NotExecutable {
+		return errors.New("--executable and --not-executable are mutually exclusive")
+	}
+	if opts.ZeroBlocks && opts.WithData {
+		return errors.New("--zero-blocks and --only-regular-with-data are mutually exclusive")
+	}
+	if opts.HasACL && opts.NoACL {
+		return errors.New("--has-acl and --no-acl are mutually exclusive")
+	}
+	if (opts.HasACL || opts.NoACL) && !aclSupported {
+		return errors.New("--has-acl and --no-acl are supported on Linux only")
+	}
+	if opts.DedupPaths && opts.UniqueInodes {
+		return errors.New("--dedup-paths is implied by --unique-inodes")
+	}
+	if opts.State != "" && (opts.TreeSummary || opts.DeletedOpen) {
+		return errors.New("--state can't be combined with --tree-summary or --deleted-open")
+	}
+	if opts.OutputRotate != 0 && (opts.Output == "" || opts.JSONArray) {
+		return errors.New("--output-rotate requires --output and can't be combined with --json-array")
+	}
+	if opts.DirsTo != "" && (opts.JSONArray || opts.DeletedOpen) {
+		return errors.New("--dirs-to can't be combined with --json-array or --deleted-open")
+	}
+	if opts.Raw && opts.QuoteWhenNeeded {
+		return errors.New("--raw and --quote-when-needed are mutually exclusive")
+	}
+	if opts.InodesOnly {
+		if opts.Columns != "" || opts.JSON || opts.JSONArray || opts.TreeSummary {
+			return errors.New("--inodes-only can't be combined with --columns, --json, --json-array or --tree-summary")
+		}
+		if opts.WithSizes || opts.WithTimes || opts.WithFstype || opts.WithRdev || opts.WithScanTime || opts.WithDirent || opts.WithSeed || opts.WithDepth || opts.WithMode {
+			return errors.New("--inodes-only outputs inodes alone and can't be combined with --with-* attributes")
+		}
+	}
+	if opts.Columns != "" {
+		if opts.Inodes || opts.InodesHex || opts.WithSizes || opts.WithTimes || opts.WithFstype || opts.WithRdev || opts.WithScanTime || opts.WithDirent || opts.WithSeed || opts.WithDepth || opts.WithMode {
+			return errors.New("--columns can't be combined with --inodes, --inodes-hex, --with-size, --with-times, --with-fstype, --with-rdev, --with-scan-time, --with-dirent, --with-seed, --with-depth or --with-mode")
+		}
+		if _, err := ParseColumns(opts.Columns); err != nil {
+			return err
+		}
+	}
+	if opts.JSON && opts.JSONArray {
+		return errors.New("--json and --json-array are mutually exclusive")
+	}
+	if opts.Quiet && opts.Verbose {
+		return errors.New("--quiet and --verbose are mutually exclusive")
+	}
+	if _, err := ParseLogLevel(opts.LogLevel); err != nil {
+		return err
+	}
+	if opts.SizeBuckets != "" {
+		if !opts.SizeHistogram {
+			return errors.New("--size-buckets requires --size-histogram")
+		}
+		if _, err := ParseSizeBuckets(opts.SizeBuckets); err != nil {
+			return err
+		}
+	}
+	if _, err := ParseAgeBuckets(opts.AgeBuckets); err != nil {
+		return err
+	}
+	if opts.Top != 0 && !opts.ExtStats {
+		return errors.New("--top requires --ext-stats")
+	}
+	if opts.Top < 0 {
+		return errors.New("--top must not be negative")
+	}
+	if opts.NameLonger < 0 || opts.NameShorter < 0 {
+		return errors.New("--name-longer and --name-shorter must not be negative")
+	}
+	if opts.TreeSummary && (opts.SizeHistogram || opts.AgeHistogram || opts.CountByType || opts.ExtStats || opts.Estimate || opts.Tree || opts.IncludeRoot || opts.AllowFileSeeds) {
+		return errors.New("--tree-summary can't be combined with reports, --include-root or --allow-file-seeds")
+	}
+	if opts.DeletedOpen && (len(opts.Args.Directories) != 0 || opts.Seeds0 != "" || opts.JSON || opts.JSONArray) {
+		return errors.New("--deleted-open scans /proc, it can't be combined with directories, --json or --json-array")
+	}
+	if opts.RelativeTo != "" && (opts.StripPrefix != "" || opts.AddPrefix != "") {
+		return errors.New("--relative-to can't be combined with --strip-prefix or --add-prefix")
+	}
+	if opts.FailIfEmpty && opts.FailIfFound {
+		return errors.New("--fail-if-empty and --fail-if-found are mutually exclusive")
+	}
+	if opts.Tree && (opts.JSON || opts.JSONArray || opts.Columns != "") {
+		return errors.New("--tree can't be combined with --json, --json-array or --columns")
+	}
+	if opts.Limit < 0 {
+		return errors.New("--limit must not be negative")
+	}
+	if opts.Chunk < 0 {
+		return errors.New("--chunk must not be negative")
+	}
+	if opts.Chunk != 0 && (opts.JSONArray || opts.TreeSummary || opts.SizeHistogram || opts.AgeHistogram || opts.CountByType || opts.ExtStats || opts.Estimate || opts.Tree) {
+		return errors.New("--chunk can't be combined with --json-array, --tree-summary or reports")
+	}
+	if opts.MaxBytes != 0 && !opts.WithSizes {
+		columns, _ := ParseColumns(opts.Columns)
+		if opts.Columns == "" || !slices.Contains(columns, columnSize) {
+			return errors.New("--max-bytes requires --with-size or size in --columns")
+		}
+	}
+	if opts.Sample <= 0 || opts.Sample > 1 {
+		return fmt.Errorf("--sample %v must be greater than 0 and at most 1", opts.Sample)
+	}
+	if opts.PerDirLimit < 0 {
+		return errors.New("--per-dir-limit must not be negative")
+	}
+	if opts.PerDirLimit != 0 && opts.TreeSummary {
+		return errors.New("--per-dir-limit can't be combined with --tree-summary")
+	}
+	if opts.SkipLargeDirs < 0 {
+		return errors.New("--skip-large-dirs must not be negative")
+	}
+	if opts.MaxDirEntries < 0 {
+		return errors.New("--max-dir-entries must not be negative")
+	}
+	if opts.StatThreads < 0 {
+		return errors.New("--stat-jobs must not be negative")
+	}
+	if opts.ThreadsPerMount < 0 {
+		return errors.New("--threads-per-mount must not be negative")
+	}
+	if opts.BatchSize < 1 {
+		return errors.New("--batch-size must be at least 1")
+	}
+	if opts.Threads < 1 {
+		return errors.New("--jobs must be at least 1")
+	}
+	if opts.ResultsPerDir < 0 {
+		return errors.New("--result-jobs-per-dir must not be negative")
+	}
+	if opts.ResultsPerDir != 0 && opts.OrderedOutput {
+		return errors.New("--result-jobs-per-dir and --ordered-output are mutually exclusive")
+	}
+	if opts.ResultThreads < 1 {
+		return errors.New("--result-jobs must be at least 1")
+	}
+	if opts.Timeout <= 0 {
+		return errors.New("--timeout must be positive")
+	}
+	if opts.Retries < 0 {
+		return errors.New("--retries must not be negative")
+	}
+	if opts.MaxErrors < 0 {
+		return errors.New("--max-errors must not be negative")
+	}
+	if opts.MaxRuntime < 0 {
+		return errors.New("--max-runtime must not be negative")
+	}
+	if opts.Progress < 0 {
+		return errors.New("--progress must not be negative")
+	}
+	for _, t := range splitTypes(opts.Type) {
+		switch t {
+		case "file", "dir", "link", "socket", "char", "block", "unknown", "all":
+		default:
+			return fmt.Errorf("unknown type %q, possible values: file, dir, link, socket, char, block, unknown, all", t)
+		}
+	}
+	timeFilters := []struct {
+		name                 string
+		olderThan, newerThan TimeFilter
+	}{
+		{"atime", opts.AtimeOlderThan, opts.AtimeNewerThan},
+		{"mtime", opts.MtimeOlderThan, opts.MtimeNewerThan},
+		{"ctime", opts.CtimeOlderThan, opts.CtimeNewerThan},
+	}
+	for _, f := range timeFilters {
+		for name, direntType := range direntTypeNames {
+			olderThan, newerThan := f.olderThan.For(direntType), f.newerThan.For(direntType)
+			if olderThan != 0 && newerThan != 0 && olderThan >= newerThan {
+				return fmt.Errorf("--%s-older %s and --%s-newer %s can never match for %s entries, older must be less than newer",
+					f.name, olderThan, f.name, newerThan, name)
+			}
+		}
+	}
+	return nil
+}
+
 func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -721,77 +1962,569 @@ func main() {
 	//TODO: Refactor Explorer to Lib with proper public API and sane defaults, so none of this calls will be necessary
 	explorer := NewExplorer(ctx)
 	explorer.resilient = !opts.StopOnError
+	explorer.maxErrors = opts.MaxErrors
+	explorer.retries = opts.Retries
+	explorer.linePrefix = opts.Prefix
+	explorer.lineSuffix = opts.Suffix
 	explorer.SetIncludedTypes(opts.Type)
 	explorer.SetThreads(opts.Threads)
 	explorer.inodes = opts.Inodes
 	explorer.inodesHex = opts.InodesHex
 	explorer.raw = opts.Raw
+	explorer.quoteWhenNeeded = opts.QuoteWhenNeeded
+	explorer.print0 = opts.Print0
+	explorer.json = opts.JSON || opts.JSONArray
+	explorer.jsonArray = opts.JSONArray
+	var output *outputWriter
+	var err error
+	if opts.OutputRotate > 0 {
+		output, err = newRotatingOutputWriter(opts.Output, int64(opts.OutputRotate), opts.Gzip, opts.Zstd, explorer.excludeOwnFile)
+	} else {
+		output, err = newOutputWriter(opts.Output, opts.Gzip, opts.Zstd)
+	}
+	if err != nil {
+		logFatalf("%v", err)
+	}
+	explorer.output = output
+	// Output written into the searched tree must not be found, let alone deleted, by the scan itself.
+	// Rotated files are excluded as they are created
+	if opts.Output == "" {
+		if info, err := os.Stdout.Stat(); err == nil {
+			explorer.excludeOwnFile(info)
+		}
+	} else if opts.OutputRotate == 0 {
+		if info, err := os.Stat(opts.Output); err == nil {
+			explorer.excludeOwnFile(info)
+		}
+	}
+	if opts.State != "" {
+		explorer.state, err = loadState(opts.State)
+		if err != nil {
+			logFatalf("%v", err)
+		}
+		if info, err := os.Stat(opts.State); err == nil {
+			explorer.excludeOwnFile(info)
+		}
+	}
+	var dirsOutput *outputWriter
+	if opts.DirsTo != "" {
+		dirsOutput, err = newOutputWriter(opts.DirsTo, opts.Gzip, opts.Zstd)
+		if err != nil {
+			logFatalf("%v", err)
+		}
+		explorer.dirsOutput = dirsOutput
+		if info, err := os.Stat(opts.DirsTo); err == nil {
+			explorer.excludeOwnFile(info)
+		}
+	}
+	closeOutputs := func() error {
+		err := output.Close()
+		if dirsOutput != nil {
+			if dirsErr := dirsOutput.Close(); err == nil {
+				err = dirsErr
+			}
+		}
+		return err
+	}
 	explorer.timeout = opts.Timeout
 	explorer.resultsThreads = opts.ResultThreads
+	explorer.batchSize = opts.BatchSize
+	explorer.traceScheduler = opts.TraceScheduler
+	if opts.LowMemory {
+		explorer.SetLowMemory()
+	}
+	explorer.threadsPerMount = opts.ThreadsPerMount
+	explorer.statThreads = opts.StatThreads
+	explorer.readdirplus = opts.Readdirplus
+	explorer.skipLargeDirs = opts.SkipLargeDirs
+	explorer.maxDirEntries = opts.MaxDirEntries
+	explorer.perDirLimit = opts.PerDirLimit
+	if explorer.statThreads == 0 {
+		explorer.statThreads = opts.Threads
+	}
+	explorer.orderedOutput = opts.OrderedOutput
+	if opts.ResultsPerDir > 0 {
+		explorer.resultSlots = newResultSlots(opts.ResultsPerDir)
+	}
+	explorer.uniqueInodes = opts.UniqueInodes
+	if opts.DedupPaths {
+		explorer.seenPaths = newSeenPaths()
+	}
 	explorer.withSizes = opts.WithSizes
 	explorer.withTimes = opts.WithTimes
+	explorer.withFstype = opts.WithFstype
+	explorer.withRdev = opts.WithRdev
+	explorer.withScanTime = opts.WithScanTime
+	explorer.withDirent = opts.WithDirent
+	explorer.withSeed = opts.WithSeed
+	explorer.withDepth = opts.WithDepth
+	explorer.withMode = opts.WithMode
+	explorer.treeSummary = opts.TreeSummary
+	explorer.summaryTypes = opts.DirReportJSON
+	explorer.nameLonger = opts.NameLonger
+	explorer.nameShorter = opts.NameShorter
+	explorer.nonNFC = opts.NonNFC
+	explorer.hasACL = opts.HasACL
+	explorer.executable = opts.Executable
+	explorer.notExecutable = opts.NotExecutable
+	explorer.zeroBlocks = opts.ZeroBlocks
+	explorer.withData = opts.WithData
+	explorer.noACL = opts.NoACL
+	if opts.Columns != "" {
+		columns, _ := ParseColumns(opts.Columns)
+		explorer.SetColumns(columns)
+	}
+	if opts.InodesOnly {
+		var columns []column
+		if opts.Inodes || !opts.InodesHex {
+			columns = append(columns, columnInode)
+		}
+		if opts.InodesHex {
+			columns = append(columns, columnInodeHex)
+		}
+		explorer.SetColumns(columns)
+	}
 	explorer.atimeOlderThan = opts.AtimeOlderThan
 	explorer.atimeNewerThan = opts.AtimeNewerThan
 	explorer.mtimeOlderThan = opts.MtimeOlderThan
 	explorer.mtimeNewerThan = opts.MtimeNewerThan
 	explorer.ctimeOlderThan = opts.CtimeOlderThan
 	explorer.ctimeNewerThan = opts.CtimeNewerThan
-	explorer.delete = opts.Delete
-	explorer.deleteAll = opts.DeleteAll
+	explorer.changedWithin = opts.ChangedWithin
+	explorer.future = opts.Future
+	explorer.quiet = opts.Quiet
+	level, _ := ParseLogLevel(opts.LogLevel)
+	if opts.Quiet {
+		level = levelWarn
+	} else if opts.Verbose {
+		level = levelDebug
+	}
+	SetLogLevel(level)
+	if opts.Delete || opts.DeleteAll {
+		deletion := &deleteAction{all: opts.DeleteAll}
+		if opts.Shred {
+			deletion.shredPasses = opts.ShredPasses
+		}
+		explorer.actions = append(explorer.actions, deletion)
+	}
+	if opts.MoveTo != "" {
+		explorer.actions = append(explorer.actions, &moveAction{destination: opts.MoveTo, onCollision: opts.OnCollision})
+	}
+	if opts.CopyTo != "" {
+		explorer.actions = append(explorer.actions, &copyAction{destination: opts.CopyTo, onCollision: opts.OnCollision})
+	}
+	if opts.Chmod != "" {
+		mode, err := ParseMode(opts.Chmod)
+		if err != nil {
+			logFatalf("%v", err)
+		}
+		explorer.actions = append(explorer.actions, &chmodAction{mode: mode})
+	}
+	if opts.Chown != "" {
+		uid, gid, err := ParseOwner(opts.Chown)
+		if err != nil {
+			logFatalf("%v", err)
+		}
+		explorer.actions = append(explorer.actions, &chownAction{uid: uid, gid: gid})
+	}
+	if opts.Touch {
+		explorer.actions = append(explorer.actions, &touchAction{})
+	}
+	if opts.TouchRef != "" {
+		atime, mtime, _, err := GetFileTimes(opts.TouchRef)
+		if err != nil {
+			logFatalf("%v", err)
+		}
+		explorer.actions = append(explorer.actions, &touchAction{reference: true, atime: atime, mtime: mtime})
+	}
+	explorer.dryRun = opts.DryRun
+	explorer.maxReadSize = int64(opts.MaxReadSize)
+	explorer.pruneEmpty = opts.PruneEmpty
+	explorer.sampleRate = opts.Sample
+	explorer.limit = opts.Limit
+	explorer.chunk = opts.Chunk
+	explorer.maxBytes = int64(opts.MaxBytes)
+	if opts.SizeHistogram {
+		var bounds []int64
+		if opts.SizeBuckets != "" {
+			bounds, _ = ParseSizeBuckets(opts.SizeBuckets)
+		}
+		explorer.reports = append(explorer.reports, newSizeHistogram(bounds))
+	}
+	if opts.AgeHistogram {
+		bounds, _ := ParseAgeBuckets(opts.AgeBuckets)
+		explorer.reports = append(explorer.reports, newAgeHistogram(bounds))
+	}
+	if opts.CountByType {
+		explorer.reports = append(explorer.reports, &typeCounts{})
+	}
+	if opts.ExtStats {
+		explorer.reports = append(explorer.reports, newExtensionStats(opts.Top))
+	}
+	if opts.Tree {
+		explorer.reports = append(explorer.reports, newTreeReport(explorer.formatName))
+	}
+	if opts.Estimate {
+		lstat := func(path string) (os.FileInfo, error) {
+			return explorer.limitStat(os.Lstat, path)
+		}
+		explorer.reports = append(explorer.reports, &estimate{lstat: lstat})
+		if len(explorer.actions) != 0 || explorer.pruneEmpty {
+			logInfof("Estimating only, actions and --prune-empty are not applied")
+			explorer.actions, explorer.pruneEmpty = nil, false
+		}
+	}
+	// --unique-inodes holds all results until the scan is complete, their directories can't be kept open that long
+	for _, a := range explorer.actions {
+		if _, ok := a.(*deleteAction); ok && !opts.DryRun && !opts.UniqueInodes {
+			explorer.unlinkAt = true
+		}
+	}
+	if opts.TreeSummary && len(explorer.actions) != 0 {
+		logFatalf("--tree-summary can't be combined with actions")
+	}
+	explorer.sampleSeed = opts.Seed
+	if opts.Sample != 1 && opts.Seed == 0 {
+		explorer.sampleSeed = rand.Uint64()
+		logInfof("Sampling with --seed %d", explorer.sampleSeed)
+	}
 
 	for _, exclude := range opts.Exclude {
 		explorer.excludes = append(explorer.excludes, glob.MustCompile(exclude))
 	}
+	if opts.RelativeTo != "" {
+		base, err := filepath.Abs(ExpandHomePath(opts.RelativeTo))
+		if err != nil {
+			logFatalf("--relative-to: %v", err)
+		}
+		explorer.relativeTo = base
+		explorer.workingDir, err = os.Getwd()
+		if err != nil {
+			logFatalf("--relative-to: %v", err)
+		}
+	}
+	explorer.realPath = opts.RealPath
+	if (opts.MatchAbsolute || opts.RealPath || explorer.hasColumn(columnAbsPath) || len(opts.SkipPath) != 0) && explorer.workingDir == "" {
+		explorer.workingDir, err = os.Getwd()
+		if err != nil {
+			logFatalf("%v", err)
+		}
+	}
+	explorer.matchAbsolute = opts.MatchAbsolute
+	explorer.stripPrefix = opts.StripPrefix
+	explorer.addPrefix = opts.AddPrefix
+	explorer.skipHiddenDirs = opts.SkipHiddenDirs
+	if opts.ReportDenied || opts.DeniedTo != "" {
+		explorer.denied = newDeniedDirs()
+	}
+	for _, skipped := range opts.SkipPath {
+		skipped = ExpandHomePath(skipped)
+		if !filepath.IsAbs(skipped) {
+			skipped = filepath.Join(explorer.workingDir, skipped)
+		}
+		explorer.skipPaths = append(explorer.skipPaths, filepath.Clean(skipped))
+	}
 	for _, filter := range opts.Filter {
 		explorer.includes = append(explorer.includes, glob.MustCompile(filter))
 	}
+	groups := make(map[string]int)
+	for _, value := range opts.FilterGroup {
+		name, pattern, _ := strings.Cut(value, ":")
+		i, ok := groups[name]
+		if !ok {
+			i = len(explorer.includeGroups)
+			groups[name] = i
+			explorer.includeGroups = append(explorer.includeGroups, nil)
+		}
+		explorer.includeGroups[i] = append(explorer.includeGroups[i], glob.MustCompile(pattern))
+	}
+	if len(opts.ExcludeInodes) != 0 {
+		explorer.excludeInodes = make(map[uint64]null, len(opts.ExcludeInodes))
+		for _, ino := range opts.ExcludeInodes {
+			explorer.excludeInodes[ino] = nullv
+		}
+	}
+	for _, inodes := range opts.ExcludeInodeRanges {
+		r, err := ParseInodeRange(inodes)
+		if err != nil {
+			logFatalf("%v", err)
+		}
+		explorer.excludeInodeRanges = append(explorer.excludeInodeRanges, r)
+	}
 
-	for _, directory := range opts.Args.Directories {
-		seed := ExpandHomePath(directory)
+	if opts.DeletedOpen {
+		files, err := findDeletedOpen("/proc", opts.Threads)
+		if err != nil {
+			logFatalf("%v", err)
+		}
+		explorer.writeDeletedOpen(output, files)
+		if err := output.Close(); err != nil {
+			logErrorf("Failed to close output: %v", err)
+		}
+		return
+	}
+
+	seeds := make([]string, len(opts.Args.Directories))
+	for i, directory := range opts.Args.Directories {
+		seeds[i] = ExpandHomePath(directory)
+	}
+	// Seeds inside of other seeds would be scanned twice, they are found by scanning their ancestors anyway unless pruned
+	var nested map[int]string
+	if !opts.prunesDescent() {
+		nested = nestedSeeds(seeds)
+	}
+	var validSeeds int
+	for i, seed := range seeds {
+		if ancestor, ok := nested[i]; ok {
+			logInfof("Skipped %s, it is searched as a part of %s", seed, ancestor)
+			validSeeds++
+			continue
+		}
+		if IsArchive(seed) {
+			if len(explorer.actions) != 0 || opts.UniqueInodes || opts.TreeSummary {
+				logFatalf("%s: archives can't be combined with actions, --unique-inodes or --tree-summary", seed)
+			}
+			if explorer.archives == nil {
+				explorer.archives = make(map[string]null)
+			}
+			explorer.archives[seed] = nullv
+			explorer.seeds = append(explorer.seeds, filepath.Clean(seed))
+			explorer.addDir(seed)
+			validSeeds++
+			continue
+		}
 		if err := IsDir(seed); err != nil {
-			log.Fatalln(seed, err)
+			if info, statErr := os.Stat(seed); statErr == nil && info.Mode().IsRegular() && opts.AllowFileSeeds {
+				// Directory of the file acts as a seed, so actions preserve its name relative to it
+				explorer.seeds = append(explorer.seeds, filepath.Dir(filepath.Clean(seed)))
+				explorer.addSeedResult(seed)
+				validSeeds++
+				continue
+			}
+			if !explorer.resilient {
+				logFatalf("%v", err)
+			}
+			logWarnf("Skipped %v", err)
+			continue
+		}
+		validSeeds++
+		explorer.seeds = append(explorer.seeds, filepath.Clean(seed))
+		if opts.IncludeRoot {
+			explorer.addSeedResult(seed)
 		}
 		explorer.addDir(seed)
 	}
+	if validSeeds == 0 {
+		logFatalf("Nothing to search, none of the given directories is valid")
+	}
+	if opts.MoveTo != "" && explorer.isInsideSeeds(opts.MoveTo) {
+		logFatalf("--move-to %s must be outside of searched directories", opts.MoveTo)
+	}
+	if opts.CopyTo != "" && explorer.isInsideSeeds(opts.CopyTo) {
+		logFatalf("--copy-to %s must be outside of searched directories", opts.CopyTo)
+	}
+
+	exit := func(code int, reason string) {
+		if opts.StatusJSON {
+			explorer.writeStatus(os.Stderr, code, reason)
+		}
+		os.Exit(code)
+	}
 
 	go func() {
 		<-quitOnInterrupt()
 		cancel()
 		<-time.After(100 * time.Millisecond)
-		os.Exit(130)
+		closeOutputs()
+		exit(130, "interrupted")
 	}()
 
+	if opts.MaxRuntime > 0 {
+		time.AfterFunc(opts.MaxRuntime, func() {
+			explorer.cancel(maxRuntimeError)
+		})
+	}
+
+	// Every job holds a directory open, every results job might hold a file open for actions
+	neededFiles := uint64(opts.Threads + opts.ResultThreads + 64)
+	if before, after, err := RaiseOpenFilesLimit(neededFiles); err != nil {
+		logWarnf("Failed to raise open files limit: %v", err)
+	} else {
+		if after != before {
+			logInfof("Raised open files limit from %d to %d", before, after)
+		}
+		if after < neededFiles {
+			logWarnf("Open files limit %d is lower than %d needed for --jobs %d, raise its hard limit or lower --jobs", after, neededFiles, opts.Threads)
+		}
+	}
+	explorer.logStatsOnSignal()
+	if opts.Progress > 0 {
+		explorer.logProgress(opts.Progress)
+	}
+	if opts.PprofAddr != "" {
+		listener, err := net.Listen("tcp", opts.PprofAddr)
+		if err != nil {
+			logFatalf("--pprof-addr: %v", err)
+		}
+		logInfof("Serving pprof on http://%s/debug/pprof/", listener.Addr())
+		go func() {
+			if err := http.Serve(listener, nil); err != nil {
+				logErrorf("--pprof-addr: %v", err)
+			}
+		}()
+	}
 	explorer.start()
-	//TODO: Check how much pprof adds to the binary, if not much - listen for a user signal to dump goroutines
-	//go func() {
-	//	<-time.After(5 * time.Second)
-	//	pprof.Lookup("goroutine").WriteTo(os.Stdout, 1)
-	//}()
 	<-explorer.done()
+	if err := closeOutputs(); err != nil {
+		logErrorf("Failed to close output: %v", err)
+	}
+	if skipped := atomic.LoadInt64(&explorer.pathsTooLong); skipped != 0 {
+		logWarnf("%d directories were skipped as their paths are too long", skipped)
+	}
+	if skipped := atomic.LoadInt64(&explorer.largeDirsSkipped); skipped != 0 {
+		logWarnf("%d directories were skipped as they have more than %d entries", skipped, opts.SkipLargeDirs)
+	}
+	if pruned := atomic.LoadInt64(&explorer.largeDirsPruned); pruned != 0 {
+		logWarnf("Subdirectories of %d directories were not searched as they have more than %d entries", pruned, opts.MaxDirEntries)
+	}
+	if explorer.denied != nil {
+		if err := explorer.writeDenied(opts.DeniedTo); err != nil {
+			logErrorf("Failed to write denied directories: %v", err)
+		}
+	}
+	if explorer.state != nil {
+		if explorer.ctx.Err() != nil {
+			logWarnf("--state %s is not updated, as the scan is incomplete", opts.State)
+		} else if err := explorer.state.save(); err != nil {
+			logErrorf("Failed to save --state: %v", err)
+		}
+	}
 	if ctx.Err() == context.Canceled {
-		os.Exit(130)
+		exit(130, "interrupted")
 	}
-
+	if context.Cause(explorer.ctx) == maxRuntimeError {
+		logWarnf("Scan aborted after %s, results are partial", opts.MaxRuntime)
+		// Same as timeout(1)
+		exit(124, "max_runtime")
+	}
+	if errors.Is(context.Cause(explorer.ctx), outputError) {
+		logErrorf("Scan aborted: %v", context.Cause(explorer.ctx))
+		exit(1, "output_error")
+	}
+	if context.Cause(explorer.ctx) == maxErrorsError {
+		logErrorf("Scan aborted after reaching %d errors of --max-errors, results are partial", opts.MaxErrors)
+		exit(1, "max_errors")
+	}
+	found := atomic.LoadInt64(&explorer.found)
+	if opts.FailIfEmpty && found == 0 {
+		exit(3, "fail_if_empty")
+	}
+	if opts.FailIfFound && found != 0 {
+		exit(3, "fail_if_found")
+	}
+	if context.Cause(explorer.ctx) == limitReachedError {
+		exit(0, "limit")
+	}
+	if context.Cause(explorer.ctx) == maxBytesReachedError {
+		exit(0, "max_bytes")
+	}
+	exit(0, "completed")
 }
 
-func ReadDirentWithDeadline(fd int, buf []byte, timeout time.Duration) (n int, err error) {
-	doneEvent := make(controlChannel)
+// ReadDirentWithDeadline calls read, giving up on it after timeout. Timed out read is left running,
+// buf must not be reused by the caller then
+func ReadDirentWithDeadline(read func(fd int, buf []byte) (int, error), fd int, buf []byte, timeout time.Duration) (int, error) {
+	type readResult struct {
+		n   int
+		err error
+	}
+	done := make(chan readResult, 1)
 	go func() {
-		n, err = syscall.ReadDirent(fd, buf)
-		doneEvent <- nullv
+		n, err := read(fd, buf)
+		done <- readResult{n, err}
 	}()
 	select {
 	case <-time.After(timeout):
 		return 0, timeoutError
-	case <-doneEvent:
-		return
+	case result := <-done:
+		return result.n, result.err
 	}
 }
 
-func OpenWithDeadline(name string, timeout time.Duration) (f *os.File, e error) {
+// maxDescriptorsBackoff is the longest pause of a job waiting for file descriptors to be freed, before giving up on directory
+const maxDescriptorsBackoff = 5 * time.Second
+
+// openDir opens directory, backing off while process is out of file descriptors instead of losing the directory.
+// Job sleeping keeps its slot, so effective concurrency drops until other jobs close their directories
+func (e *Explorer) openDir(dir string, parent *dirHandle) (*os.File, error) {
+	delay := 10 * time.Millisecond
+	var file *os.File
+	err := e.retry(dir, func() error {
+		for {
+			var err error
+			file, err = OpenWithDeadline(dir, parent, e.timeout)
+			if !errors.Is(err, syscall.EMFILE) && !errors.Is(err, syscall.ENFILE) || delay > maxDescriptorsBackoff || e.ctx.Err() != nil {
+				return err
+			}
+			e.descriptorsHint.Do(func() {
+				logWarnf("Out of file descriptors, slowing down. Raise the limit with ulimit -n or lower --jobs to avoid it")
+			})
+			time.Sleep(delay)
+			delay *= 2
+		}
+	})
+	return file, err
+}
+
+// readDirent reads next entries of directory, retrying transient errors with --retries
+func (e *Explorer) readDirent(dir string, fd int, buff []byte) (int, error) {
+	var n int
+	err := e.retry(dir, func() error {
+		var err error
+		n, err = ReadDirentWithDeadline(e.readDirentSyscall, fd, buff, e.timeout)
+		return err
+	})
+	return n, err
+}
+
+// retryBackoff is the pause before the first retry of a transient error, doubled on every next one
+const retryBackoff = 100 * time.Millisecond
+
+// retry calls operation on dir until it succeeds, fails with an error which is not transient or --retries are exhausted
+func (e *Explorer) retry(dir string, operation func() error) error {
+	delay := retryBackoff
+	for attempt := 0; ; attempt++ {
+		err := operation()
+		if err == nil || attempt >= e.retries || !isTransient(err) || e.ctx.Err() != nil {
+			return err
+		}
+		logWarnf("%s %v, retrying in %s", dir, err, delay)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// isTransient tells whether error might go away on its own, like ESTALE during NFS server failover
+func isTransient(err error) bool {
+	return errors.Is(err, syscall.ESTALE) || errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EIO)
+}
+
+// OpenWithDeadline opens directory name, relative to parent if it is set. Timed out open keeps its own reference to parent
+func OpenWithDeadline(name string, parent *dirHandle, timeout time.Duration) (f *os.File, e error) {
 	doneEvent := make(controlChannel)
+	if parent != nil {
+		parent.acquire()
+	}
 	go func() {
-		f, e = os.Open(name)
+		if parent != nil {
+			f, e = OpenAt(parent.file, filepath.Base(name), name)
+			parent.release()
+		} else {
+			f, e = os.Open(name)
+			if errors.Is(e, syscall.ENAMETOOLONG) {
+				f, e = OpenLongPath(name)
+			}
+		}
 		doneEvent <- nullv
 	}()
 	select {
@@ -814,6 +2547,8 @@ func entryType(direntType uint8) string {
 		return "socket"
 	case syscall.DT_CHR:
 		return "char"
+	case syscall.DT_BLK:
+		return "block"
 	default:
 		return fmt.Sprintf("unknown(%v)", direntType)
 	}
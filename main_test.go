@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/jessevdk/go-flags"
+	"golang.org/x/sys/unix"
+)
+
+func init() {
+	SetLogOutput(io.Discard)
+}
+
+// newTestExplorer returns explorer searching for all types of entries, like --type all
+func newTestExplorer() *Explorer {
+	e := NewExplorer(context.Background())
+	e.SetIncludedTypes([]string{"all"})
+	return e
+}
+
+// scan runs explorer over seeds as main does and returns sorted lines of its output
+func scan(t *testing.T, e *Explorer, seeds ...string) []string {
+	t.Helper()
+	var output bytes.Buffer
+	e.output = &output
+	e.SetThreads(4)
+	for _, seed := range seeds {
+		e.addDir(seed)
+	}
+	e.start()
+	<-e.done()
+	lines := strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n")
+	if len(lines) == 1 && lines[0] == "" {
+		lines = nil
+	}
+	slices.Sort(lines)
+	return lines
+}
+
+// makeTree creates files at given paths relative to a temporary directory, along with their parents
+func makeTree(t *testing.T, paths ...string) string {
+	t.Helper()
+	root := t.TempDir()
+	for _, path := range paths {
+		full := filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(path), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestScan(t *testing.T) {
+	root := makeTree(t, "a", "sub/b")
+	lines := scan(t, newTestExplorer(), root)
+	expected := []string{filepath.Join(root, "a"), filepath.Join(root, "sub") + "/", filepath.Join(root, "sub/b")}
+	if !slices.Equal(lines, expected) {
+		t.Fatalf("expected %q, got %q", expected, lines)
+	}
+}
+
+func TestReaddirTimeout(t *testing.T) {
+	root := makeTree(t, "a")
+	unblock := make(chan null)
+	defer close(unblock)
+	e := newTestExplorer()
+	e.timeout = 20 * time.Millisecond
+	e.readDirentSyscall = func(fd int, buf []byte) (int, error) {
+		<-unblock
+		return 0, nil
+	}
+	if lines := scan(t, e, root); len(lines) != 0 {
+		t.Fatalf("expected no results of timed out directory, got %q", lines)
+	}
+	if errors := atomic.LoadInt64(&e.errorCount); errors != 1 {
+		t.Fatalf("expected timeout to be counted as an error, got %d errors", errors)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, test := range []struct {
+		args  []string
+		valid bool
+	}{
+		{[]string{"--chmod", "0644", "--touch"}, true},
+		{[]string{"--move-to", "/tmp/x", "--on-collision", "suffix"}, true},
+		{[]string{"--delete", "--chmod", "0644"}, false},
+		{[]string{"--delete-all", "--touch"}, false},
+		{[]string{"--move-to", "/tmp/x", "--chown", "root"}, false},
+		{[]string{"--copy-to", "/tmp/x", "--touch-ref", "/tmp/ref"}, false},
+		{[]string{"--sample", "0.5"}, true},
+		{[]string{"--sample", "0"}, false},
+		{[]string{"--sample", "-0.1"}, false},
+		{[]string{"--sample", "1.5"}, false},
+	} {
+		var opts Options
+		if _, err := flags.ParseArgs(&opts, test.args); err != nil {
+			t.Fatalf("%q: %v", test.args, err)
+		}
+		if err := opts.validate(); (err == nil) != test.valid {
+			t.Errorf("%q: expected valid %v, got %v", test.args, test.valid, err)
+		}
+	}
+}
+
+func TestConfigRejectsActions(t *testing.T) {
+	for _, test := range []struct {
+		config string
+		valid  bool
+	}{
+		{"jobs = 64\nwith-size = true", true},
+		{"delete = true", false},
+		{"delete-all = true", false},
+		{"shred = true", false},
+		{"chmod = 0644", false},
+		{"move-to = /tmp/x", false},
+	} {
+		config := filepath.Join(t.TempDir(), "locar.ini")
+		if err := os.WriteFile(config, []byte("[Application Options]\n"+test.config+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		var opts Options
+		parser := flags.NewParser(&opts, flags.Default)
+		if err := readConfig(parser, config); (err == nil) != test.valid {
+			t.Errorf("%q: expected valid %v, got %v", test.config, test.valid, err)
+		}
+		if _, err := parser.ParseArgs([]string{"--delete"}); err != nil || !opts.Delete {
+			t.Errorf("%q: expected --delete to be accepted on the command line, got %v", test.config, err)
+		}
+	}
+}
+
+// makeDeepTree creates chain of directories which path exceeds PATH_MAX, with a file at its bottom, returns path of the file
+func makeDeepTree(t *testing.T, root string) string {
+	t.Helper()
+	component := strings.Repeat("d", 200)
+	fd, err := unix.Open(root, openDirFlags, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := root
+	for len(path) <= unix.PathMax {
+		if err := unix.Mkdirat(fd, component, 0755); err != nil {
+			t.Fatal(err)
+		}
+		next, err := unix.Openat(fd, component, openDirFlags, 0)
+		unix.Close(fd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fd, path = next, path+"/"+component
+	}
+	defer unix.Close(fd)
+	file, err := unix.Openat(fd, "bottom", unix.O_CREAT|unix.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unix.Close(file)
+	t.Cleanup(func() {
+		// Too long paths can't be removed by path, so the chain is removed by the shell
+		exec.Command("rm", "-rf", filepath.Join(root, component)).Run()
+	})
+	return path + "/bottom"
+}
+
+func TestOpenLongPath(t *testing.T) {
+	bottom := makeDeepTree(t, t.TempDir())
+	file, err := OpenLongPath(filepath.Dir(bottom))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	names, err := file.Readdirnames(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(names, []string{"bottom"}) {
+		t.Fatalf("expected bottom, got %q", names)
+	}
+}
+
+func TestScanLongPaths(t *testing.T) {
+	root := t.TempDir()
+	bottom := makeDeepTree(t, root)
+	e := NewExplorer(context.Background())
+	e.SetIncludedTypes([]string{"file"})
+	lines := scan(t, e, root)
+	if !slices.Equal(lines, []string{bottom}) {
+		t.Fatalf("expected %d long bytes path, got %q", len(bottom), lines)
+	}
+	if skipped := atomic.LoadInt64(&e.pathsTooLong); skipped != 0 {
+		t.Fatalf("expected no directories skipped, got %d", skipped)
+	}
+	if held := atomic.LoadInt64(&e.heldDirs); held != 0 {
+		t.Fatalf("expected all directories to be closed, %d are still held", held)
+	}
+}
+
+// readUnknownTypes reads directory entries as filesystems without dirent types do, with DT_UNKNOWN for all of them
+func readUnknownTypes(fd int, buf []byte) (int, error) {
+	n, err := syscall.ReadDirent(fd, buf)
+	for offset := 0; offset < n; {
+		dirent := (*syscall.Dirent)(unsafe.Pointer(&buf[offset]))
+		dirent.Type = syscall.DT_UNKNOWN
+		offset += int(dirent.Reclen)
+	}
+	return n, err
+}
+
+func TestResolveUnknownTypes(t *testing.T) {
+	root := makeTree(t, "file", "dir/nested")
+	if err := os.Symlink("file", filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+	e := NewExplorer(context.Background())
+	e.readDirentSyscall = readUnknownTypes
+	e.SetIncludedTypes([]string{"file,link"})
+	expected := []string{filepath.Join(root, "dir/nested"), filepath.Join(root, "file"), filepath.Join(root, "link")}
+	if lines := scan(t, e, root); !slices.Equal(lines, expected) {
+		t.Fatalf("expected types of entries to be resolved and directories descended into, expected %q, got %q", expected, lines)
+	}
+
+	e = NewExplorer(context.Background())
+	e.readDirentSyscall = readUnknownTypes
+	e.SetIncludedTypes([]string{"dir"})
+	columns, err := ParseColumns("path,dirent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.SetColumns(columns)
+	lines := scan(t, e, root)
+	if len(lines) != 1 || !strings.HasPrefix(lines[0], filepath.Join(root, "dir")+"/ ") || !strings.HasSuffix(lines[0], ":0") {
+		t.Fatalf("expected resolved directory with raw DT_UNKNOWN dirent type, got %q", lines)
+	}
+}
+
+func TestQualifiedTimeFilterExcludesOtherTypes(t *testing.T) {
+	root := makeTree(t, "file", "dir/nested")
+	for _, filter := range []string{"--mtime-older", "--changed-within"} {
+		var opts Options
+		if _, err := flags.ParseArgs(&opts, []string{filter, "file:100d"}); err != nil {
+			t.Fatal(err)
+		}
+		e := newTestExplorer()
+		e.mtimeOlderThan, e.changedWithin = opts.MtimeOlderThan, opts.ChangedWithin
+		expected := []string{filepath.Join(root, "dir/nested"), filepath.Join(root, "file")}
+		if filter == "--mtime-older" {
+			expected = nil
+		}
+		if lines := scan(t, e, root); !slices.Equal(lines, expected) {
+			t.Errorf("%s file:100d: expected %q, got %q", filter, expected, lines)
+		}
+	}
+}
+
+// failingWriter fails every write, like a file on a full disk
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, syscall.ENOSPC
+}
+
+func TestDirsOutputFailureCancelsScan(t *testing.T) {
+	root := makeTree(t, "dir/file")
+	e := newTestExplorer()
+	e.dirsOutput = failingWriter{}
+	scan(t, e, root)
+	if cause := context.Cause(e.ctx); !errors.Is(cause, outputError) {
+		t.Fatalf("expected scan to be cancelled by %v, got %v", outputError, cause)
+	}
+}
+
+func TestOutputFailureCancelsScan(t *testing.T) {
+	root := makeTree(t, "file")
+	e := newTestExplorer()
+	e.SetThreads(4)
+	e.output = failingWriter{}
+	e.addDir(root)
+	e.start()
+	<-e.done()
+	if cause := context.Cause(e.ctx); !errors.Is(cause, outputError) {
+		t.Fatalf("expected scan to be cancelled by %v, got %v", outputError, cause)
+	}
+}
+
+func TestSkipPathOfRelativeSeed(t *testing.T) {
+	root := makeTree(t, "keep/a", "skip/b")
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(root); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	e := newTestExplorer()
+	e.workingDir = root
+	e.skipPaths = []string{filepath.Join(root, "skip")}
+	expected := []string{"keep/", "keep/a", "skip/"}
+	if lines := scan(t, e, "."); !slices.Equal(lines, expected) {
+		t.Fatalf("expected %q, got %q", expected, lines)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"path/filepath"
+	"sync"
+)
+
+// dirTask is a directory waiting to be read
+type dirTask struct {
+	path string
+	// dev is device of the directory, assumed to be the one of its parent until it is opened.
+	// It is known only if needed, like for --threads-per-mount
+	dev uint64
+	// seed is the searched directory task was found under, for --with-seed
+	seed string
+	// depth is number of path components below the seed, for --with-depth
+	depth int
+	// self is result of the directory itself waiting for its times, which are taken from fstat once it is opened
+	self *Result
+	// parent is kept open for directory which path is too long to be opened by itself, it is opened relative to it
+	parent *dirHandle
+}
+
+// mountSlots limits concurrent readdirs per device for --threads-per-mount, so a slow mount can't occupy all jobs.
+// Directories of a saturated device wait aside and are handed over to the jobs of that device as they finish
+type mountSlots struct {
+	sync.Mutex
+	limit   int
+	busy    map[uint64]int
+	waiting map[uint64][]dirTask
+}
+
+func newMountSlots(limit int) *mountSlots {
+	return &mountSlots{limit: limit, busy: make(map[uint64]int), waiting: make(map[uint64][]dirTask)}
+}
+
+// acquire takes a slot of task's device, or parks the task until one of device's jobs picks it up with next
+func (m *mountSlots) acquire(task dirTask) bool {
+	if m == nil {
+		return true
+	}
+	m.Lock()
+	defer m.Unlock()
+	if m.busy[task.dev] < m.limit {
+		m.busy[task.dev]++
+		return true
+	}
+	m.waiting[task.dev] = append(m.waiting[task.dev], task)
+	return false
+}
+
+// next returns parked task of dev for a job which is done with its directory, or releases job's slot if there is none
+func (m *mountSlots) next(dev uint64) (dirTask, bool) {
+	if m == nil {
+		return dirTask{}, false
+	}
+	m.Lock()
+	defer m.Unlock()
+	if waiting := m.waiting[dev]; len(waiting) != 0 {
+		task := waiting[len(waiting)-1]
+		if len(waiting) == 1 {
+			delete(m.waiting, dev)
+		} else {
+			m.waiting[dev] = waiting[:len(waiting)-1]
+		}
+		return task, true
+	}
+	m.busy[dev]--
+	if m.busy[dev] == 0 {
+		delete(m.busy, dev)
+	}
+	return dirTask{}, false
+}
+
+// resultSlots limits batches of results processed concurrently per source directory for --result-jobs-per-dir,
+// so stats and actions on entries of a huge directory can't occupy all result jobs. Batches of a saturated
+// directory wait aside and are handed over to the jobs of that directory as they finish
+type resultSlots struct {
+	sync.Mutex
+	limit   int
+	busy    map[string]int
+	waiting map[string][][]Result
+}
+
+func newResultSlots(limit int) *resultSlots {
+	return &resultSlots{limit: limit, busy: make(map[string]int), waiting: make(map[string][][]Result)}
+}
+
+// acquire takes a slot of dir, or parks its batch until one of dir's jobs picks it up with next
+func (s *resultSlots) acquire(dir string, data []Result) bool {
+	s.Lock()
+	defer s.Unlock()
+	if s.busy[dir] < s.limit {
+		s.busy[dir]++
+		return true
+	}
+	s.waiting[dir] = append(s.waiting[dir], data)
+	return false
+}
+
+// next returns parked batch of dir for a job which is done with its batch, or releases job's slot if there is none
+func (s *resultSlots) next(dir string) ([]Result, bool) {
+	s.Lock()
+	defer s.Unlock()
+	if waiting := s.waiting[dir]; len(waiting) != 0 {
+		data := waiting[0]
+		if len(waiting) == 1 {
+			delete(s.waiting, dir)
+		} else {
+			s.waiting[dir] = waiting[1:]
+		}
+		return data, true
+	}
+	s.busy[dir]--
+	if s.busy[dir] == 0 {
+		delete(s.busy, dir)
+	}
+	return nil, false
+}
+
+// groupByDir splits results by directories they were found in, keeping their order within every directory
+func groupByDir(data []Result) (dirs []string, groups map[string][]Result) {
+	groups = make(map[string][]Result)
+	for _, result := range data {
+		dir := filepath.Dir(result.path())
+		if _, ok := groups[dir]; !ok {
+			dirs = append(dirs, dir)
+		}
+		groups[dir] = append(groups[dir], result)
+	}
+	return dirs, groups
+}
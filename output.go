@@ -0,0 +1,572 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/klauspost/compress/zstd"
+	"golang.org/x/sys/unix"
+)
+
+// jsonSchemaVersion is bumped on any incompatible change of jsonResult
+const jsonSchemaVersion = 1
+
+// jsonResult is a line of --json output
+type jsonResult struct {
+	V int `json:"v"`
+	// Path holds names which are valid UTF-8, rest are base64 encoded into PathB64 as JSON can't represent them
+	Path     string            `json:"path,omitempty"`
+	PathB64  []byte            `json:"path_b64,omitempty"`
+	Type     string            `json:"type"`
+	Ino      uint64            `json:"ino"`
+	Size     *int64            `json:"size,omitempty"`
+	Atime    *int64            `json:"atime,omitempty"`
+	Mtime    *int64            `json:"mtime,omitempty"`
+	Ctime    *int64            `json:"ctime,omitempty"`
+	FSType   string            `json:"fstype,omitempty"`
+	Rdev     string            `json:"rdev,omitempty"`
+	Mode     string            `json:"mode,omitempty"`
+	ScanTime string            `json:"scan_time,omitempty"`
+	Dirent   *jsonDirent       `json:"dirent,omitempty"`
+	Seed     string            `json:"seed,omitempty"`
+	Depth    *int              `json:"depth,omitempty"`
+	AbsPath  string            `json:"abs_path,omitempty"`
+	RelPath  string            `json:"rel_path,omitempty"`
+	Future   []string          `json:"future,omitempty"`
+	Files    *int64            `json:"files,omitempty"`
+	Dirs     *int64            `json:"dirs,omitempty"`
+	Types    map[string]int64  `json:"types,omitempty"`
+	Actions  map[string]string `json:"actions,omitempty"`
+}
+
+// jsonDirent is the raw dirent record of --with-dirent
+type jsonDirent struct {
+	Reclen uint16 `json:"reclen"`
+	Type   uint8  `json:"type"`
+}
+
+// writeResult applies actions to result and renders it into out, or feeds it to reports if any
+func (e *Explorer) writeResult(result Result, out *bytes.Buffer) {
+	defer result.dir.release()
+	if result.summary != nil {
+		e.writeSummary(result, out)
+		return
+	}
+	var size *int64
+	var info os.FileInfo
+	if result.info() != nil {
+		info = result.info()
+		if e.withSizes {
+			fileSize := info.Size()
+			size = &fileSize
+		}
+	} else if e.withSizes || e.reportsNeedInfo() || e.withRdev && isDevice(result.dtype) || e.withMode {
+		fileStat, err := e.limitStat(os.Lstat, result.name)
+		if err != nil {
+			logWarnf("%v", err)
+		} else {
+			info = fileStat
+			if e.withSizes {
+				fileSize := fileStat.Size()
+				size = &fileSize
+			}
+		}
+	}
+	if size != nil {
+		if total := atomic.AddInt64(&e.bytesFound, *size); e.maxBytes > 0 && total >= e.maxBytes {
+			e.cancel(maxBytesReachedError)
+		}
+	}
+	outcomes := make([]string, len(e.actions))
+	for i, a := range e.actions {
+		outcomes[i] = e.applyAction(a, result)
+	}
+
+	if len(e.reports) != 0 {
+		for _, r := range e.reports {
+			if info != nil || !r.needsInfo() {
+				r.add(result, info)
+			}
+		}
+		return
+	}
+
+	if e.realPath && result.info() == nil {
+		result.name = e.resolvePath(result)
+	}
+
+	var rdev string
+	if e.withRdev && info != nil && isDevice(result.dtype) {
+		rdev = formatRdev(info)
+	}
+	var mode string
+	if e.withMode && info != nil {
+		mode = FormatMode(info.Mode())
+	}
+
+	if e.json {
+		e.writeJSONResult(result, size, rdev, mode, outcomes, out)
+		return
+	}
+
+	out.WriteString(e.linePrefix)
+	for i, c := range e.columns {
+		if i != 0 {
+			out.WriteByte(' ')
+		}
+		switch c {
+		case columnPath:
+			out.WriteString(e.formatName(e.displayPath(result)))
+		case columnInode:
+			out.WriteString(strconv.FormatUint(result.ino, 10))
+		case columnInodeHex:
+			out.WriteString("0x" + strconv.FormatUint(result.ino, 16))
+		case columnSize:
+			if size == nil {
+				out.WriteString("0")
+			} else {
+				out.WriteString(strconv.FormatInt(*size, 10))
+			}
+		case columnAtime:
+			out.WriteString(strconv.FormatInt(result.atime.Unix(), 10))
+		case columnMtime:
+			out.WriteString(strconv.FormatInt(result.mtime.Unix(), 10))
+		case columnCtime:
+			out.WriteString(strconv.FormatInt(result.ctime.Unix(), 10))
+		case columnFstype:
+			out.WriteString(fsTypeName(result.fstype()))
+		case columnRdev:
+			if rdev == "" {
+				out.WriteString("-")
+			} else {
+				out.WriteString(rdev)
+			}
+		case columnScanTime:
+			out.WriteString(time.Now().Format(scanTimeLayout))
+		case columnDirent:
+			if reclen, direntType := result.dirent(); reclen == 0 {
+				out.WriteString("-")
+			} else {
+				out.WriteString(strconv.FormatUint(uint64(reclen), 10) + ":" + strconv.FormatUint(uint64(direntType), 10))
+			}
+		case columnSeed:
+			out.WriteString(e.formatName(result.seed()))
+		case columnDepth:
+			out.WriteString(strconv.Itoa(result.depth()))
+		case columnMode:
+			if mode == "" {
+				out.WriteString("-")
+			} else {
+				out.WriteString(mode)
+			}
+		case columnAbsPath:
+			out.WriteString(e.formatName(e.absPath(result)))
+		case columnRelPath:
+			out.WriteString(e.formatName(relPath(result)))
+		}
+	}
+	if e.future && e.withTimes {
+		if future := futureTimes(result); len(future) != 0 {
+			out.WriteString(" [future:" + strings.Join(future, ",") + "]")
+		}
+	}
+	for i, outcome := range outcomes {
+		if outcome != actionSuccess || !e.quiet {
+			out.WriteString(" [" + e.actions[i].name() + "_" + outcome + "]")
+		}
+	}
+	out.WriteString(e.lineSuffix)
+	out.WriteString(e.recordSeparator())
+}
+
+// futureTimes names times of result which are in the future, for --future
+func futureTimes(result Result) []string {
+	now := time.Now()
+	var future []string
+	if result.mtime.After(now) {
+		future = append(future, "mtime")
+	}
+	if result.ctime.After(now) {
+		future = append(future, "ctime")
+	}
+	return future
+}
+
+// recordSeparator returns what terminates every result in text output
+func (e *Explorer) recordSeparator() string {
+	if e.print0 {
+		return "\x00"
+	}
+	return "\n"
+}
+
+// writeSummary renders --tree-summary line of directory as "path: N files, N dirs, size"
+func (e *Explorer) writeSummary(result Result, out *bytes.Buffer) {
+	summary := result.summary
+	if e.json {
+		record := jsonResult{
+			V:     jsonSchemaVersion,
+			Type:  entryType(result.dtype),
+			Ino:   result.ino,
+			Size:  &summary.size,
+			Files: &summary.files,
+			Dirs:  &summary.dirs,
+		}
+		if summary.types != nil {
+			record.Types = make(map[string]int64, len(summary.types))
+			for direntType, count := range summary.types {
+				record.Types[entryType(direntType)] += count
+			}
+		}
+		e.encodeJSON(result, record, out)
+		return
+	}
+	out.WriteString(e.formatName(e.displayPath(result)))
+	out.WriteString(": " + strconv.FormatInt(summary.files, 10) + " files, " + strconv.FormatInt(summary.dirs, 10) + " dirs, " + strconv.FormatInt(summary.size, 10))
+	out.WriteString(e.recordSeparator())
+}
+
+func (e *Explorer) writeJSONResult(result Result, size *int64, rdev, mode string, outcomes []string, out *bytes.Buffer) {
+	record := jsonResult{
+		V:    jsonSchemaVersion,
+		Type: entryType(result.dtype),
+		Ino:  result.ino,
+		Size: size,
+		Rdev: rdev,
+		Mode: mode,
+	}
+	if e.hasColumn(columnAtime) {
+		atime := result.atime.Unix()
+		record.Atime = &atime
+	}
+	if e.hasColumn(columnMtime) {
+		mtime := result.mtime.Unix()
+		record.Mtime = &mtime
+	}
+	if e.hasColumn(columnCtime) {
+		ctime := result.ctime.Unix()
+		record.Ctime = &ctime
+	}
+	if e.hasColumn(columnFstype) {
+		record.FSType = fsTypeName(result.fstype())
+	}
+	if e.hasColumn(columnScanTime) {
+		record.ScanTime = time.Now().Format(scanTimeLayout)
+	}
+	if reclen, direntType := result.dirent(); e.hasColumn(columnDirent) && reclen != 0 {
+		record.Dirent = &jsonDirent{Reclen: reclen, Type: direntType}
+	}
+	if e.hasColumn(columnSeed) {
+		record.Seed = result.seed()
+	}
+	if e.hasColumn(columnDepth) {
+		depth := result.depth()
+		record.Depth = &depth
+	}
+	if e.hasColumn(columnAbsPath) {
+		record.AbsPath = e.absPath(result)
+	}
+	if e.hasColumn(columnRelPath) {
+		record.RelPath = relPath(result)
+	}
+	if e.future && e.withTimes {
+		record.Future = futureTimes(result)
+	}
+	if len(outcomes) != 0 {
+		record.Actions = make(map[string]string, len(outcomes))
+		for i, outcome := range outcomes {
+			record.Actions[e.actions[i].name()] = outcome
+		}
+	}
+	e.encodeJSON(result, record, out)
+}
+
+// encodeJSON writes record with path of result as a line of --json output, or an element of --json-array
+func (e *Explorer) encodeJSON(result Result, record jsonResult, out *bytes.Buffer) {
+	path := e.displayPath(result)
+	if utf8.ValidString(path) {
+		record.Path = path
+	} else {
+		record.PathB64 = []byte(path)
+	}
+	start := out.Len()
+	if e.jsonArray {
+		// Every element is preceded by a separator, the one of the very first element is dropped when writing
+		out.WriteString(",\n")
+	}
+	encoder := json.NewEncoder(out)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(record); err != nil {
+		logErrorf("%s %v", result.name, err)
+		out.Truncate(start)
+		return
+	}
+	if e.jsonArray {
+		out.Truncate(out.Len() - 1)
+	}
+}
+
+// reportsNeedInfo tells whether results have to be statted for any of reports
+func (e *Explorer) reportsNeedInfo() bool {
+	for _, r := range e.reports {
+		if r.needsInfo() {
+			return true
+		}
+	}
+	return false
+}
+
+// isDevice tells whether dirent type is a char or block device
+func isDevice(direntType uint8) bool {
+	return direntType == syscall.DT_CHR || direntType == syscall.DT_BLK
+}
+
+// formatRdev renders device numbers of device file as major:minor
+func formatRdev(info os.FileInfo) string {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return ""
+	}
+	rdev := uint64(stat.Rdev)
+	return strconv.FormatUint(uint64(unix.Major(rdev)), 10) + ":" + strconv.FormatUint(uint64(unix.Minor(rdev)), 10)
+}
+
+// absPath returns path of result resolved against the working directory, with trailing separator for directories
+func (e *Explorer) absPath(result Result) string {
+	if filepath.IsAbs(result.name) {
+		return result.name
+	}
+	return withDirSuffix(filepath.Join(e.workingDir, result.name), result.dtype)
+}
+
+// resolvePath returns canonical absolute path of result for --realpath, or its path as found if it can't be resolved
+func (e *Explorer) resolvePath(result Result) string {
+	defer e.statSlot()()
+	resolved, err := filepath.EvalSymlinks(e.absPath(result))
+	if err != nil {
+		logWarnf("Can't resolve %s: %v", result.name, err)
+		return result.name
+	}
+	return withDirSuffix(resolved, result.dtype)
+}
+
+// relPath returns path of result relative to its seed, with trailing separator for directories
+func relPath(result Result) string {
+	rel, err := filepath.Rel(result.seed(), result.path())
+	if err != nil {
+		return result.name
+	}
+	return withDirSuffix(rel, result.dtype)
+}
+
+func withDirSuffix(path string, dtype uint8) string {
+	if dtype == syscall.DT_DIR && !strings.HasSuffix(path, string(filepath.Separator)) {
+		return path + string(filepath.Separator)
+	}
+	return path
+}
+
+// displayPath returns path of result as it is printed, relative to --relative-to base if set.
+// Results outside of the base are printed with absolute paths
+func (e *Explorer) displayPath(result Result) string {
+	if e.stripPrefix != "" || e.addPrefix != "" {
+		return e.addPrefix + stripPathPrefix(result.name, e.stripPrefix)
+	}
+	if e.relativeTo == "" {
+		return result.name
+	}
+	path := result.path()
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(e.workingDir, path)
+	}
+	if rel, ok := relativeInside(e.relativeTo, path); ok {
+		path = rel
+	}
+	if result.dtype == syscall.DT_DIR && !strings.HasSuffix(path, string(filepath.Separator)) {
+		path += string(filepath.Separator)
+	}
+	return path
+}
+
+// stripPathPrefix removes prefix from name if it ends at a path component boundary,
+// so /mnt/snap is stripped from /mnt/snap/a but not from /mnt/snapshot/a
+func stripPathPrefix(name, prefix string) string {
+	rest, ok := strings.CutPrefix(name, prefix)
+	if !ok || rest != "" && !strings.HasSuffix(prefix, string(filepath.Separator)) && !strings.HasPrefix(rest, string(filepath.Separator)) {
+		return name
+	}
+	return rest
+}
+
+// formatName renders entry name for output. Names are arbitrary bytes, --raw escapes them losslessly
+// including invalid UTF-8 and control characters, so strconv.Unquote restores the original name
+func (e *Explorer) formatName(name string) string {
+	if e.raw || e.quoteWhenNeeded && needsQuoting(name) {
+		return strconv.Quote(name)
+	}
+	return name
+}
+
+// needsQuoting tells whether name is ambiguous or unsafe to print as is: it has invalid UTF-8,
+// control, non-printable or space characters, or quotes and backslashes which would be mistaken for escaping
+func needsQuoting(name string) bool {
+	for _, r := range name {
+		if r == utf8.RuneError || r == ' ' || r == '"' || r == '\\' || !unicode.IsPrint(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// outputWriter is where results are written to, optionally through a compressor.
+// Close is safe to call concurrently with Write and more than once, so interrupt handler can finalize
+// compressed stream while results are still being dumped and archive stays readable
+type outputWriter struct {
+	sync.Mutex
+	writer  io.Writer
+	closers []io.Closer
+	closed  bool
+	gzipped bool
+	zstded  bool
+
+	// With --output-rotate output goes to files named after path, start time and sequence number,
+	// the next one is started by the first write after rotateSize bytes, before compression, were written
+	path       string
+	rotateSize int64
+	started    time.Time
+	sequence   int
+	written    int64
+	// created is called with every file created for output
+	created func(info os.FileInfo)
+}
+
+// newOutputWriter opens path for writing (stdout if empty) and wraps it with compression if requested
+func newOutputWriter(path string, gzipped, zstded bool) (*outputWriter, error) {
+	out := &outputWriter{writer: os.Stdout, gzipped: gzipped, zstded: zstded}
+	if err := out.open(path); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// newRotatingOutputWriter writes output to files named after path, started anew after every size bytes
+func newRotatingOutputWriter(path string, size int64, gzipped, zstded bool, created func(info os.FileInfo)) (*outputWriter, error) {
+	out := &outputWriter{gzipped: gzipped, zstded: zstded, path: path, rotateSize: size, started: time.Now(), created: created}
+	if err := out.open(out.rotatedPath()); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// rotatedPath names the current file of rotated output as path with start time and sequence number
+// before extension, e.g. scan-20240514T103626-0001.txt.gz for scan.txt.gz
+func (o *outputWriter) rotatedPath() string {
+	dir, name := filepath.Split(o.path)
+	base, ext := splitExt(name)
+	return filepath.Join(dir, fmt.Sprintf("%s-%s-%04d%s", base, o.started.Format("20060102T150405"), o.sequence+1, ext))
+}
+
+// splitExt splits name at its last dot, along with extension of compression before it if any, e.g. scan.v2 and .txt.gz
+// for scan.v2.txt.gz. Leading dot of hidden files like .out doesn't start an extension
+func splitExt(name string) (base, ext string) {
+	for _, compressed := range []string{".gz", ".zst"} {
+		if inner, ok := strings.CutSuffix(name, compressed); ok && inner != "" && inner != "." {
+			base, ext = splitExt(inner)
+			return base, ext + compressed
+		}
+	}
+	ext = filepath.Ext(name)
+	if ext == name {
+		return name, ""
+	}
+	return strings.TrimSuffix(name, ext), ext
+}
+
+// open starts writing to file at path (stdout if empty), compressing it if requested
+func (o *outputWriter) open(path string) error {
+	o.closers = nil
+	if path != "" {
+		file, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		o.writer = file
+		o.closers = append(o.closers, file)
+		if o.created != nil {
+			if info, err := file.Stat(); err == nil {
+				o.created(info)
+			}
+		}
+	}
+	switch {
+	case o.gzipped:
+		compressor := gzip.NewWriter(o.writer)
+		o.writer = compressor
+		o.closers = append(o.closers, compressor)
+	case o.zstded:
+		compressor, err := zstd.NewWriter(o.writer)
+		if err != nil {
+			o.closeWriters()
+			return err
+		}
+		o.writer = compressor
+		o.closers = append(o.closers, compressor)
+	}
+	return nil
+}
+
+func (o *outputWriter) Write(p []byte) (int, error) {
+	o.Lock()
+	defer o.Unlock()
+	if o.closed {
+		return 0, os.ErrClosed
+	}
+	if o.rotateSize > 0 && o.written >= o.rotateSize {
+		if err := o.closeWriters(); err != nil {
+			return 0, err
+		}
+		o.sequence++
+		o.written = 0
+		if err := o.open(o.rotatedPath()); err != nil {
+			o.closed = true
+			return 0, err
+		}
+	}
+	n, err := o.writer.Write(p)
+	o.written += int64(n)
+	return n, err
+}
+
+// Close flushes and closes compressor first and only then underlying file
+func (o *outputWriter) Close() error {
+	o.Lock()
+	defer o.Unlock()
+	if o.closed {
+		return nil
+	}
+	o.closed = true
+	return o.closeWriters()
+}
+
+func (o *outputWriter) closeWriters() error {
+	var firstErr error
+	for i := len(o.closers) - 1; i >= 0; i-- {
+		if err := o.closers[i].Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
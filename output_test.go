@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+var awkwardNames = []string{"plain", "with space", "new\nline", "tab\there", "bell\a", "invalid\xff\xfeutf8", "quote\"and\\backslash", "unicode✓"}
+
+func TestFormatNameRoundTrip(t *testing.T) {
+	for _, quoteWhenNeeded := range []bool{false, true} {
+		e := &Explorer{raw: !quoteWhenNeeded, quoteWhenNeeded: quoteWhenNeeded}
+		for _, name := range awkwardNames {
+			formatted := e.formatName(name)
+			if quoteWhenNeeded && !needsQuoting(name) {
+				if formatted != name {
+					t.Errorf("expected %q to be printed as is, got %s", name, formatted)
+				}
+				continue
+			}
+			unquoted, err := strconv.Unquote(formatted)
+			if err != nil || unquoted != name {
+				t.Errorf("expected %s to unquote to %q, got %q, %v", formatted, name, unquoted, err)
+			}
+		}
+	}
+}
+
+func TestScanRawRoundTrip(t *testing.T) {
+	root := t.TempDir()
+	var expected []string
+	for _, name := range awkwardNames {
+		path := filepath.Join(root, name)
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		expected = append(expected, path)
+	}
+	slices.Sort(expected)
+	e := NewExplorer(context.Background())
+	e.SetIncludedTypes([]string{"file"})
+	e.raw = true
+	var paths []string
+	for _, line := range scan(t, e, root) {
+		path, err := strconv.Unquote(line)
+		if err != nil {
+			t.Fatalf("%s: %v", line, err)
+		}
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+	if !slices.Equal(paths, expected) {
+		t.Fatalf("expected %q, got %q", expected, paths)
+	}
+}
+
+func TestSeedAndDepthColumns(t *testing.T) {
+	root := makeTree(t, "a", "sub/b", "sub/deeper/c")
+	e := newTestExplorer()
+	columns, err := ParseColumns("depth,seed,relpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.SetColumns(columns)
+	expected := []string{"1 " + root + " a", "1 " + root + " sub/", "2 " + root + " sub/b", "2 " + root + " sub/deeper/", "3 " + root + " sub/deeper/c"}
+	if lines := scan(t, e, root); !slices.Equal(lines, expected) {
+		t.Fatalf("expected %q, got %q", expected, lines)
+	}
+}
+
+func TestStripPathPrefix(t *testing.T) {
+	for _, test := range []struct {
+		name, prefix, expected string
+	}{
+		{"/mnt/snap/a", "/mnt/snap", "/a"},
+		{"/mnt/snap/a", "/mnt/snap/", "a"},
+		{"/mnt/snap", "/mnt/snap", ""},
+		{"/mnt/snap/", "/mnt/snap", "/"},
+		{"/mnt/snapshot/a", "/mnt/snap", "/mnt/snapshot/a"},
+		{"/mnt/snapshot/a", "/mnt/sn", "/mnt/snapshot/a"},
+		{"/other/a", "/mnt/snap", "/other/a"},
+	} {
+		if stripped := stripPathPrefix(test.name, test.prefix); stripped != test.expected {
+			t.Errorf("stripping %q from %q: expected %q, got %q", test.prefix, test.name, test.expected, stripped)
+		}
+	}
+}
+
+func TestSplitExt(t *testing.T) {
+	for _, test := range []struct {
+		name, base, ext string
+	}{
+		{"scan.txt", "scan", ".txt"},
+		{"scan.txt.gz", "scan", ".txt.gz"},
+		{"scan.v2.txt.zst", "scan.v2", ".txt.zst"},
+		{"scan.2024.05.txt", "scan.2024.05", ".txt"},
+		{"scan", "scan", ""},
+		{".out", ".out", ""},
+		{".out.gz", ".out", ".gz"},
+		{"scan.gz", "scan", ".gz"},
+	} {
+		if base, ext := splitExt(test.name); base != test.base || ext != test.ext {
+			t.Errorf("%s: expected %q and %q, got %q and %q", test.name, test.base, test.ext, base, ext)
+		}
+	}
+}
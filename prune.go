@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+)
+
+// emptyCandidates holds parents of deleted entries, which might end up empty once the scan is complete
+type emptyCandidates struct {
+	sync.Mutex
+	dirs map[string]null
+}
+
+// addEmptyCandidate records parent directory of successfully removed entry for --prune-empty
+func (e *Explorer) addEmptyCandidate(removed string) {
+	parent := filepath.Dir(removed)
+	e.emptyCandidates.Lock()
+	if e.emptyCandidates.dirs == nil {
+		e.emptyCandidates.dirs = make(map[string]null)
+	}
+	e.emptyCandidates.dirs[parent] = nullv
+	e.emptyCandidates.Unlock()
+}
+
+// pruneEmptyDirs removes directories left empty by deletes, cascading upwards until a seed directory.
+// It runs only after all results are processed, so concurrent traversal can't refill or race with it
+func (e *Explorer) pruneEmptyDirs() {
+	e.emptyCandidates.Lock()
+	candidates := e.emptyCandidates.dirs
+	e.emptyCandidates.dirs = nil
+	e.emptyCandidates.Unlock()
+
+	for len(candidates) != 0 {
+		parents := make(map[string]null)
+		for dir := range candidates {
+			if !e.isUnderSeed(dir) {
+				continue
+			}
+			if err := os.Remove(dir); err != nil {
+				if !errors.Is(err, syscall.ENOTEMPTY) && !errors.Is(err, syscall.EEXIST) && !os.IsNotExist(err) {
+					logErrorf("Prune failed: %s - Error: %v", dir, err)
+				}
+				continue
+			}
+			logInfof("Pruned empty directory: %s", dir)
+			parents[filepath.Dir(dir)] = nullv
+		}
+		candidates = parents
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+// report aggregates results instead of listing them, it is written once the scan is complete.
+// Reports are fed concurrently from results workers. Entries are statted only for reports which need info,
+// the rest are given nil info
+type report interface {
+	add(result Result, info os.FileInfo)
+	write(out io.Writer)
+	needsInfo() bool
+}
+
+// histogram counts entries and their total size per bucket of some value.
+// Bucket i holds values in [bounds[i-1], bounds[i]), first and last buckets are open ended
+type histogram struct {
+	sync.Mutex
+	title  string
+	bounds []int64
+	label  func(value int64) string
+	// sparse histograms omit empty buckets at both ends, useful with many fine-grained default buckets
+	sparse bool
+	counts []int64
+	bytes  []int64
+}
+
+func newHistogram(title string, bounds []int64, label func(int64) string, sparse bool) *histogram {
+	return &histogram{
+		title:  title,
+		bounds: bounds,
+		label:  label,
+		sparse: sparse,
+		counts: make([]int64, len(bounds)+1),
+		bytes:  make([]int64, len(bounds)+1),
+	}
+}
+
+func (h *histogram) observe(value, size int64) {
+	bucket := sort.Search(len(h.bounds), func(i int) bool { return h.bounds[i] > value })
+	h.Lock()
+	h.counts[bucket]++
+	h.bytes[bucket] += size
+	h.Unlock()
+}
+
+func (h *histogram) needsInfo() bool {
+	return true
+}
+
+func (h *histogram) write(out io.Writer) {
+	h.Lock()
+	defer h.Unlock()
+	first, last := 0, len(h.counts)-1
+	if h.sparse {
+		for first < last && h.counts[first] == 0 {
+			first++
+		}
+		for last > first && h.counts[last] == 0 {
+			last--
+		}
+	}
+	table := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(table, "%s\tCOUNT\tBYTES\n", h.title)
+	for i := first; i <= last; i++ {
+		var name string
+		switch {
+		case i == 0:
+			name = "<" + h.label(h.bounds[0])
+		case i == len(h.bounds):
+			name = ">=" + h.label(h.bounds[i-1])
+		default:
+			name = h.label(h.bounds[i-1]) + "-" + h.label(h.bounds[i])
+		}
+		fmt.Fprintf(table, "%s\t%d\t%d\n", name, h.counts[i], h.bytes[i])
+	}
+	table.Flush()
+}
+
+// powersOfTwo returns bounds 1, 2, 4 and so on up to the largest int64 power of two
+func powersOfTwo() []int64 {
+	bounds := make([]int64, 0, 63)
+	for shift := 0; shift < 63; shift++ {
+		bounds = append(bounds, 1<<shift)
+	}
+	return bounds
+}
+
+// sizeHistogram buckets entries by their size
+type sizeHistogram struct {
+	*histogram
+}
+
+// newSizeHistogram uses powers of two if no bounds given
+func newSizeHistogram(bounds []int64) sizeHistogram {
+	if len(bounds) == 0 {
+		return sizeHistogram{newHistogram("SIZE", powersOfTwo(), formatSize, true)}
+	}
+	return sizeHistogram{newHistogram("SIZE", bounds, formatSize, false)}
+}
+
+func formatSize(size int64) string {
+	return ByteSize(size).String()
+}
+
+func (h sizeHistogram) add(_ Result, info os.FileInfo) {
+	h.observe(info.Size(), info.Size())
+}
+
+// ageHistogram buckets entries by age of their modification time, relative to the scan start
+type ageHistogram struct {
+	*histogram
+	now time.Time
+}
+
+func newAgeHistogram(bounds []int64) ageHistogram {
+	label := func(age int64) string { return FormatAge(time.Duration(age)) }
+	return ageHistogram{histogram: newHistogram("AGE", bounds, label, false), now: time.Now()}
+}
+
+func (h ageHistogram) add(result Result, info os.FileInfo) {
+	mtime := result.mtime
+	if mtime.IsZero() {
+		mtime = info.ModTime()
+	}
+	h.observe(int64(h.now.Sub(mtime)), info.Size())
+}
+
+// extensionStats tallies entries and their total size per file extension, directories are not counted
+type extensionStats struct {
+	sync.Mutex
+	counts map[string]int64
+	bytes  map[string]int64
+	// top limits output to this many largest extensions, all if 0
+	top int
+}
+
+func newExtensionStats(top int) *extensionStats {
+	return &extensionStats{counts: make(map[string]int64), bytes: make(map[string]int64), top: top}
+}
+
+func (s *extensionStats) add(result Result, info os.FileInfo) {
+	if info.IsDir() {
+		return
+	}
+	ext := filepath.Ext(result.name)
+	s.Lock()
+	s.counts[ext]++
+	s.bytes[ext] += info.Size()
+	s.Unlock()
+}
+
+func (s *extensionStats) needsInfo() bool {
+	return true
+}
+
+func (s *extensionStats) write(out io.Writer) {
+	s.Lock()
+	defer s.Unlock()
+	extensions := make([]string, 0, len(s.counts))
+	for ext := range s.counts {
+		extensions = append(extensions, ext)
+	}
+	sort.Slice(extensions, func(i, j int) bool {
+		a, b := extensions[i], extensions[j]
+		if s.bytes[a] != s.bytes[b] {
+			return s.bytes[a] > s.bytes[b]
+		}
+		return a < b
+	})
+	if s.top > 0 && len(extensions) > s.top {
+		extensions = extensions[:s.top]
+	}
+	table := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(table, "EXTENSION\tCOUNT\tBYTES\n")
+	for _, ext := range extensions {
+		name := ext
+		if name == "" {
+			name = "(none)"
+		}
+		fmt.Fprintf(table, "%s\t%d\t%d\n", name, s.counts[ext], s.bytes[ext])
+	}
+	table.Flush()
+}
+
+// typeCounts counts entries per dirent type, which is known without statting them
+type typeCounts struct {
+	counts [256]int64
+}
+
+// typeCountsOrder is the order selectable types are listed in, other types follow by their dirent type value
+var typeCountsOrder = []uint8{syscall.DT_REG, syscall.DT_DIR, syscall.DT_LNK, syscall.DT_SOCK, syscall.DT_CHR, syscall.DT_BLK}
+
+func (c *typeCounts) add(result Result, _ os.FileInfo) {
+	atomic.AddInt64(&c.counts[result.dtype], 1)
+}
+
+func (c *typeCounts) needsInfo() bool {
+	return false
+}
+
+func (c *typeCounts) write(out io.Writer) {
+	order := append([]uint8{}, typeCountsOrder...)
+	for direntType := range c.counts {
+		if !isSelectableType(uint8(direntType)) {
+			order = append(order, uint8(direntType))
+		}
+	}
+	var total int64
+	table := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(table, "TYPE\tCOUNT\n")
+	for _, direntType := range order {
+		count := atomic.LoadInt64(&c.counts[direntType])
+		if count == 0 {
+			continue
+		}
+		total += count
+		fmt.Fprintf(table, "%s\t%d\n", entryType(direntType), count)
+	}
+	fmt.Fprintf(table, "total\t%d\n", total)
+	table.Flush()
+}
+
+// estimateSampleEvery is how often files are statted by --estimate, their average size is extrapolated to the rest
+const estimateSampleEvery = 100
+
+// estimate counts entries without statting most of them, for a quick plan before applying actions.
+// Total size is extrapolated from every estimateSampleEvery-th file
+type estimate struct {
+	entries      int64
+	files        int64
+	sampled      int64
+	sampledBytes int64
+
+	// lstat stats sampled files, within --stat-jobs limit like the rest of the scan
+	lstat func(path string) (os.FileInfo, error)
+}
+
+func (s *estimate) add(result Result, _ os.FileInfo) {
+	atomic.AddInt64(&s.entries, 1)
+	if result.dtype == syscall.DT_DIR {
+		return
+	}
+	if atomic.AddInt64(&s.files, 1)%estimateSampleEvery != 1 {
+		return
+	}
+	info := result.info()
+	if info == nil {
+		var err error
+		if info, err = s.lstat(result.name); err != nil {
+			logWarnf("%v", err)
+			return
+		}
+	}
+	atomic.AddInt64(&s.sampled, 1)
+	atomic.AddInt64(&s.sampledBytes, info.Size())
+}
+
+func (s *estimate) needsInfo() bool {
+	return false
+}
+
+func (s *estimate) write(out io.Writer) {
+	files, sampled := atomic.LoadInt64(&s.files), atomic.LoadInt64(&s.sampled)
+	var bytes int64
+	if sampled != 0 {
+		// Computed in floating point, product of sampled bytes and files overflows int64 for large trees
+		bytes = int64(float64(atomic.LoadInt64(&s.sampledBytes)) / float64(sampled) * float64(files))
+	}
+	table := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(table, "ENTRIES\tFILES\tBYTES\tSAMPLED\n")
+	fmt.Fprintf(table, "%d\t%d\t~%d\t%d\n", atomic.LoadInt64(&s.entries), files, bytes, sampled)
+	table.Flush()
+}
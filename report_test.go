@@ -0,0 +1,17 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestEstimateLargeTrees(t *testing.T) {
+	// A billion files of 1MB on average, product of sampled bytes and files would overflow int64
+	s := &estimate{entries: 1e9, files: 1e9, sampled: 1e7, sampledBytes: 1e7 * 1e6}
+	var out bytes.Buffer
+	s.write(&out)
+	if !strings.Contains(out.String(), " ~1000000000000000 ") {
+		t.Fatalf("expected 1PB estimate, got:\n%s", out.String())
+	}
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"hash/fnv"
+	"math/rand/v2"
+)
+
+// newSampler returns PRNG deciding which results of dir are emitted by --sample, or nil if sampling is off.
+// Every directory gets its own generator derived from seed and directory path, so workers don't contend on
+// a shared source and the same seed picks the same entries no matter how directories are scheduled
+func (e *Explorer) newSampler(dir string) *rand.Rand {
+	if e.sampleRate <= 0 || e.sampleRate >= 1 {
+		return nil
+	}
+	hash := fnv.New64a()
+	hash.Write([]byte(dir))
+	return rand.New(rand.NewPCG(e.sampleSeed, hash.Sum64()))
+}
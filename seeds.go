@@ -0,0 +1,152 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+	"golang.org/x/text/unicode/norm"
+)
+
+// ReadSeeds0 reads NUL separated seeds from file at path, or stdin if path is -, so seeds may contain newlines
+func ReadSeeds0(path string) ([]string, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var seeds []string
+	for _, seed := range strings.Split(string(data), "\x00") {
+		if seed != "" {
+			seeds = append(seeds, seed)
+		}
+	}
+	return seeds, nil
+}
+
+// relativeInside returns path relative to base, if path is base itself or located inside of it
+func relativeInside(base, path string) (string, bool) {
+	rel, err := filepath.Rel(base, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
+
+// prunesDescent tells whether any option skips directories during the scan, then seeds inside of other seeds
+// might not be reached from them and have to be scanned on their own
+func (opts *Options) prunesDescent() bool {
+	return opts.SkipHiddenDirs || opts.SkipLargeDirs > 0 || opts.MaxDirEntries > 0 || len(opts.SkipPath) != 0 ||
+		len(opts.Exclude) != 0 || len(opts.ExcludeInodes) != 0 || len(opts.ExcludeInodeRanges) != 0
+}
+
+// nestedSeeds finds seeds located inside of other seeds, or repeating them, which would be scanned twice.
+// It maps index of such seed to the seed containing it. Only directories contain other seeds,
+// archives are scanned as directories only when given as seeds, so they are never nested
+func nestedSeeds(seeds []string) map[int]string {
+	absolute := make([]string, len(seeds))
+	for i, seed := range seeds {
+		if IsArchive(seed) {
+			continue
+		}
+		absolute[i], _ = filepath.Abs(seed)
+	}
+	nested := make(map[int]string)
+	for i := range seeds {
+		for j := range seeds {
+			if i == j || absolute[i] == "" || absolute[j] == "" || IsDir(seeds[j]) != nil {
+				continue
+			}
+			rel, ok := relativeInside(absolute[j], absolute[i])
+			if ok && (rel != "." || j < i) {
+				nested[i] = seeds[j]
+				break
+			}
+		}
+	}
+	return nested
+}
+
+// isUnderSeed tells whether dir is strictly inside of one of the seed directories
+func (e *Explorer) isUnderSeed(dir string) bool {
+	for _, seed := range e.seeds {
+		if rel, ok := relativeInside(seed, dir); ok && rel != "." {
+			return true
+		}
+	}
+	return false
+}
+
+// seedRelative returns path relative to the closest seed it was found in
+func (e *Explorer) seedRelative(path string) string {
+	relative := path
+	for _, seed := range e.seeds {
+		if rel, ok := relativeInside(seed, path); ok && len(rel) < len(relative) {
+			relative = rel
+		}
+	}
+	return relative
+}
+
+// isInsideSeeds tells whether path is one of the seed directories or located inside of them
+func (e *Explorer) isInsideSeeds(path string) bool {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	for _, seed := range e.seeds {
+		absSeed, err := filepath.Abs(seed)
+		if err != nil {
+			continue
+		}
+		if _, ok := relativeInside(absSeed, absPath); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// addSeedResult emits seed itself as a result, subject to the same filters as found entries.
+// Seed is either a searched directory or a file given with --allow-file-seeds
+func (e *Explorer) addSeedResult(seed string) {
+	if e.isNotIncluded(seed) || e.isExcluded(seed) {
+		return
+	}
+	info, err := os.Stat(seed)
+	if err != nil {
+		e.reportError(seed, err)
+		return
+	}
+	dtype := direntTypeOf(info.Mode())
+	stat := info.Sys().(*syscall.Stat_t)
+	if !e.includesType(dtype) || e.isExcludedInode(uint64(stat.Ino)) || !e.matchesNameLength(len(info.Name())) ||
+		e.nonNFC && norm.NFC.IsNormalString(info.Name()) {
+		return
+	}
+	name := filepath.Clean(seed)
+	if dtype == syscall.DT_DIR && !strings.HasSuffix(name, string(filepath.Separator)) {
+		name += string(filepath.Separator)
+	}
+	origin := &dirTask{path: filepath.Dir(filepath.Clean(seed)), seed: filepath.Clean(seed), depth: -1}
+	result := Result{name: name, ino: uint64(stat.Ino), dev: uint64(stat.Dev), dtype: dtype, origin: origin}
+	if e.needsTimes() {
+		if ok, err := e.checkFileTimeConditions(unix.AT_FDCWD, seed, seed, &result); err != nil || !ok {
+			return
+		}
+	}
+	if !e.matchesACL(seed) || !e.matchesStat(unix.AT_FDCWD, seed, seed) {
+		return
+	}
+	if e.state != nil && !e.state.changed(seed, info.ModTime(), info.Size()) {
+		return
+	}
+	e.addResults([]Result{result})
+}
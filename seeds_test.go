@@ -0,0 +1,58 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/jessevdk/go-flags"
+)
+
+func TestNestedSeeds(t *testing.T) {
+	root := makeTree(t, "sub/file", "other/file")
+	sub, other := filepath.Join(root, "sub"), filepath.Join(root, "other")
+	nested := nestedSeeds([]string{sub, root, other, root + "/", filepath.Join(sub, "file")})
+	expected := map[int]string{0: root, 2: root, 3: root, 4: sub}
+	if len(nested) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, nested)
+	}
+	for i, ancestor := range expected {
+		if nested[i] != ancestor {
+			t.Errorf("expected seed %d to be nested in %s, got %q", i, ancestor, nested[i])
+		}
+	}
+}
+
+func TestPrunesDescent(t *testing.T) {
+	for _, test := range []struct {
+		args   []string
+		prunes bool
+	}{
+		{nil, false},
+		{[]string{"--filter", "*.log"}, false},
+		{[]string{"--skip-hidden-dirs"}, true},
+		{[]string{"--skip-large-dirs", "1000"}, true},
+		{[]string{"--max-dir-entries", "1000"}, true},
+		{[]string{"--skip-path", "/proc"}, true},
+		{[]string{"--exclude", "*/cache"}, true},
+		{[]string{"--exclude-inode", "2"}, true},
+	} {
+		var opts Options
+		if _, err := flags.ParseArgs(&opts, test.args); err != nil {
+			t.Fatal(err)
+		}
+		if prunes := opts.prunesDescent(); prunes != test.prunes {
+			t.Errorf("%q: expected %v, got %v", test.args, test.prunes, prunes)
+		}
+	}
+}
+
+func TestNestedSeedUnderPrunedDirectory(t *testing.T) {
+	root := makeTree(t, ".hidden/file", "visible")
+	e := newTestExplorer()
+	e.skipHiddenDirs = true
+	expected := []string{filepath.Join(root, ".hidden") + "/", filepath.Join(root, ".hidden/file"), filepath.Join(root, "visible")}
+	if lines := scan(t, e, root, filepath.Join(root, ".hidden")); !slices.Equal(lines, expected) {
+		t.Fatalf("expected %q, got %q", expected, lines)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// stateEntry is what is remembered of entry by --state to tell whether it changed since the previous scan
+type stateEntry struct {
+	Mtime int64
+	Size  int64
+}
+
+// scanState is --state file of the previous scan. Entries unchanged since then are not output,
+// and once the scan is complete entries found by it replace the previous ones.
+// Entries are keyed by absolute paths, so relative and absolute seeds of the same tree share the state
+type scanState struct {
+	sync.Mutex
+	path       string
+	workingDir string
+	previous   map[string]stateEntry
+	current    map[string]stateEntry
+}
+
+// loadState reads state saved at path, state is empty if the file doesn't exist yet
+func loadState(path string) (*scanState, error) {
+	workingDir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	state := &scanState{path: path, workingDir: workingDir, previous: make(map[string]stateEntry), current: make(map[string]stateEntry)}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		logInfof("No state in %s yet, all entries are new", path)
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if err := gob.NewDecoder(bufio.NewReader(file)).Decode(&state.previous); err != nil {
+		return nil, &os.PathError{Op: "read state", Path: path, Err: err}
+	}
+	return state, nil
+}
+
+// changed records entry and tells whether it is new or has different mtime or size than in the previous scan
+func (s *scanState) changed(path string, mtime time.Time, size int64) bool {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(s.workingDir, path)
+	}
+	entry := stateEntry{Mtime: mtime.UnixNano(), Size: size}
+	s.Lock()
+	defer s.Unlock()
+	s.current[path] = entry
+	previous, seen := s.previous[path]
+	return !seen || previous != entry
+}
+
+// changedAt is changed of --state for entry statted by name relative to dirfd within --stat-jobs limit,
+// entries failing stat are treated as changed
+func (e *Explorer) changedAt(dirfd int, name, fullpath string) bool {
+	var stat unix.Stat_t
+	release := e.statSlot()
+	err := unix.Fstatat(dirfd, name, &stat, unix.AT_SYMLINK_NOFOLLOW)
+	release()
+	if err != nil {
+		logWarnf("%v", &os.PathError{Op: "stat", Path: fullpath, Err: err})
+		return true
+	}
+	return e.state.changed(fullpath, time.Unix(stat.Mtim.Unix()), stat.Size)
+}
+
+// save replaces the state file with entries of the current scan, atomically so an interrupted save keeps the previous one
+func (s *scanState) save() error {
+	s.Lock()
+	defer s.Unlock()
+	gone := 0
+	for path := range s.previous {
+		if _, ok := s.current[path]; !ok {
+			gone++
+		}
+	}
+	if gone != 0 {
+		logInfof("%d entries of the previous state are gone", gone)
+	}
+	temp := s.path + ".tmp"
+	file, err := os.Create(temp)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	if err := gob.NewEncoder(writer).Encode(s.current); err != nil {
+		file.Close()
+		os.Remove(temp)
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		os.Remove(temp)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(temp)
+		return err
+	}
+	return os.Rename(temp, s.path)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// scanStats is a snapshot of scan progress counters
+type scanStats struct {
+	elapsed     time.Duration
+	dirsScanned int64
+	inFlight    int64
+	queued      int64
+	pending     int64
+	found       int64
+	errors      int64
+}
+
+func (s scanStats) String() string {
+	return fmt.Sprintf("elapsed: %s, directories scanned: %d, in flight: %d, queued: %d, results pending: %d, results written: %d, errors: %d",
+		s.elapsed.Round(time.Millisecond), s.dirsScanned, s.inFlight, s.queued, s.pending, s.found, s.errors)
+}
+
+// stats collects current counters, it is safe to call while scan is running
+func (e *Explorer) stats() scanStats {
+	e.dirStore.Lock()
+	queued := int64(len(e.dirStore.store) + len(e.directories))
+	e.dirStore.Unlock()
+	e.resultStore.Lock()
+	pending := int64(e.resultStore.length)
+	e.resultStore.Unlock()
+	return scanStats{
+		elapsed:     time.Since(e.startTime),
+		dirsScanned: atomic.LoadInt64(&e.dirsScanned),
+		inFlight:    atomic.LoadInt64(&e.inFlight),
+		queued:      queued,
+		pending:     pending,
+		found:       atomic.LoadInt64(&e.found),
+		errors:      atomic.LoadInt64(&e.errorCount),
+	}
+}
+
+// scanStatus is the final --status-json object
+type scanStatus struct {
+	Results     int64 `json:"results"`
+	Errors      int64 `json:"errors"`
+	DirsScanned int64 `json:"dirs_scanned"`
+	// Bytes is total size of results, known only if they were statted for it
+	Bytes       *int64  `json:"bytes,omitempty"`
+	Duration    float64 `json:"duration"`
+	Interrupted bool    `json:"interrupted"`
+	ExitCode    int     `json:"exit_code"`
+	Reason      string  `json:"reason"`
+}
+
+// writeStatus writes --status-json object for scan ending with exit code for reason
+func (e *Explorer) writeStatus(out io.Writer, code int, reason string) {
+	stats := e.stats()
+	status := scanStatus{
+		Results:     stats.found,
+		Errors:      stats.errors,
+		DirsScanned: stats.dirsScanned,
+		Duration:    stats.elapsed.Seconds(),
+		Interrupted: reason == "interrupted",
+		ExitCode:    code,
+		Reason:      reason,
+	}
+	if e.withSizes {
+		bytes := atomic.LoadInt64(&e.bytesFound)
+		status.Bytes = &bytes
+	}
+	if err := json.NewEncoder(out).Encode(status); err != nil {
+		logErrorf("Failed to write status: %v", err)
+	}
+}
+
+// logStatsOnSignal logs current stats on every SIGUSR1 regardless of log level, to peek into long running scans
+func (e *Explorer) logStatsOnSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1)
+	go func() {
+		for range signals {
+			logger.Output(2, "STATS "+e.stats().String())
+		}
+	}()
+}
+
+// progressWindow is how far back --progress looks for the rate of scanned directories
+const progressWindow = time.Minute
+
+type progressSample struct {
+	at          time.Time
+	dirsScanned int64
+}
+
+// logProgress logs stats every interval regardless of log level, along with rate of scanned directories over
+// progressWindow and time to scan directories in flight at that rate. Directories found later are not
+// known yet, so the estimate is rather a lower bound until the tree is mostly discovered
+func (e *Explorer) logProgress(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		samples := []progressSample{{at: time.Now()}}
+		for range ticker.C {
+			stats := e.stats()
+			now := time.Now()
+			samples = append(samples, progressSample{at: now, dirsScanned: stats.dirsScanned})
+			for len(samples) > 2 && now.Sub(samples[1].at) >= progressWindow {
+				samples = samples[1:]
+			}
+			first := samples[0]
+			rate := float64(stats.dirsScanned-first.dirsScanned) / now.Sub(first.at).Seconds()
+			// Queued directories are counted in flight too
+			remaining := stats.inFlight
+			eta := "unknown"
+			if rate > 0 {
+				eta = "~" + time.Duration(float64(remaining)/rate*float64(time.Second)).Round(time.Second).String()
+			}
+			logger.Output(2, fmt.Sprintf("STATS %s, rate: %.1f dirs/s, remaining: ~%d dirs, eta: %s", stats, rate, remaining, eta))
+		}
+	}()
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// maxFailureExamples is the number of paths kept per failure reason for the summary
+const maxFailureExamples = 3
+
+// actionSummary aggregates outcomes of actions, to report totals once results are processed
+// instead of making one scroll through the log of every entry
+type actionSummary struct {
+	sync.Mutex
+	// outcomes counts outcome per action name
+	outcomes map[string]map[string]int64
+	// failures groups failures per action name by reason, the errno if there is one
+	failures map[string]map[string]*failureGroup
+}
+
+type failureGroup struct {
+	count    int64
+	examples []string
+}
+
+func (s *actionSummary) add(actionName, outcome, path string, err error) {
+	s.Lock()
+	defer s.Unlock()
+	if s.outcomes == nil {
+		s.outcomes = make(map[string]map[string]int64)
+		s.failures = make(map[string]map[string]*failureGroup)
+	}
+	if s.outcomes[actionName] == nil {
+		s.outcomes[actionName] = make(map[string]int64)
+		s.failures[actionName] = make(map[string]*failureGroup)
+	}
+	s.outcomes[actionName][outcome]++
+	if outcome != actionFailed {
+		return
+	}
+	reason := failureReason(err)
+	group := s.failures[actionName][reason]
+	if group == nil {
+		group = &failureGroup{}
+		s.failures[actionName][reason] = group
+	}
+	group.count++
+	if len(group.examples) < maxFailureExamples {
+		group.examples = append(group.examples, path)
+	}
+}
+
+// failureReason names errno of err (e.g., EACCES), so failures of the same kind are grouped together
+func failureReason(err error) string {
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		if name := unix.ErrnoName(errno); name != "" {
+			return fmt.Sprintf("%s (%v)", name, errno)
+		}
+		return errno.Error()
+	}
+	return "other"
+}
+
+// log writes the summary regardless of log level, as it replaces per entry messages suppressed by --quiet
+func (s *actionSummary) log(actions []action) {
+	s.Lock()
+	defer s.Unlock()
+	for _, a := range actions {
+		outcomes := s.outcomes[a.name()]
+		var totals []string
+		for _, outcome := range []string{actionSuccess, actionFailed, actionSkipped, actionDryRun} {
+			if count := outcomes[outcome]; count != 0 || outcome == actionSuccess || outcome == actionFailed {
+				totals = append(totals, fmt.Sprintf("%d %s", count, strings.ReplaceAll(outcome, "_", " ")))
+			}
+		}
+		logger.Output(2, fmt.Sprintf("SUMMARY %s: %s", a.name(), strings.Join(totals, ", ")))
+
+		failures := s.failures[a.name()]
+		reasons := make([]string, 0, len(failures))
+		for reason := range failures {
+			reasons = append(reasons, reason)
+		}
+		sort.Slice(reasons, func(i, j int) bool {
+			return failures[reasons[i]].count > failures[reasons[j]].count
+		})
+		for _, reason := range reasons {
+			group := failures[reason]
+			logger.Output(2, fmt.Sprintf("SUMMARY %s failed with %s: %d, e.g. %s",
+				a.name(), reason, group.count, strings.Join(group.examples, ", ")))
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// treeReport renders results indented under their seeds like tree(1), set by --tree.
+// Results arrive concurrently in no particular order, so all of them are held until the scan is complete.
+// Directories filtered out themselves are still shown when anything under them was found
+type treeReport struct {
+	sync.Mutex
+	roots  map[string]*treeNode
+	format func(string) string
+}
+
+type treeNode struct {
+	children map[string]*treeNode
+	dir      bool
+}
+
+func newTreeReport(format func(string) string) *treeReport {
+	return &treeReport{roots: make(map[string]*treeNode), format: format}
+}
+
+func (t *treeReport) needsInfo() bool {
+	return false
+}
+
+func (t *treeReport) add(result Result, _ os.FileInfo) {
+	rel, err := filepath.Rel(result.seed(), result.path())
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		rel = "."
+	}
+	t.Lock()
+	defer t.Unlock()
+	node := t.roots[result.seed()]
+	if node == nil {
+		node = &treeNode{}
+		t.roots[result.seed()] = node
+	}
+	if rel != "." {
+		for _, name := range strings.Split(rel, string(filepath.Separator)) {
+			if node.children == nil {
+				node.children = make(map[string]*treeNode)
+			}
+			child := node.children[name]
+			if child == nil {
+				child = &treeNode{}
+				node.children[name] = child
+			}
+			node = child
+		}
+	}
+	if result.dtype == syscall.DT_DIR {
+		node.dir = true
+	}
+}
+
+func (t *treeReport) write(out io.Writer) {
+	t.Lock()
+	defer t.Unlock()
+	writer := bufio.NewWriter(out)
+	var dirs, files int64
+	var walk func(node *treeNode, indent string)
+	walk = func(node *treeNode, indent string) {
+		names := make([]string, 0, len(node.children))
+		for name := range node.children {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for i, name := range names {
+			child := node.children[name]
+			branch, nested := "├── ", "│   "
+			if i == len(names)-1 {
+				branch, nested = "└── ", "    "
+			}
+			writer.WriteString(indent + branch + t.format(name))
+			if child.dir || child.children != nil {
+				writer.WriteString(string(filepath.Separator))
+				dirs++
+			} else {
+				files++
+			}
+			writer.WriteString("\n")
+			walk(child, indent+nested)
+		}
+	}
+	seeds := make([]string, 0, len(t.roots))
+	for seed := range t.roots {
+		seeds = append(seeds, seed)
+	}
+	slices.Sort(seeds)
+	for _, seed := range seeds {
+		writer.WriteString(t.format(seed) + "\n")
+		walk(t.roots[seed], "")
+	}
+	fmt.Fprintf(writer, "\n%s, %s\n", plural(dirs, "directory", "directories"), plural(files, "file", "files"))
+	writer.Flush()
+}
+
+func plural(count int64, one, many string) string {
+	if count == 1 {
+		return "1 " + one
+	}
+	return fmt.Sprintf("%d %s", count, many)
+}
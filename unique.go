@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// fileID identifies a file regardless of the path it was reached by
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// seenPaths drops results with paths already output, for --dedup-paths. Paths are compared as absolute,
+// so relative and absolute seeds of the same tree are deduplicated too
+type seenPaths struct {
+	workingDir string
+	paths      map[string]null
+}
+
+func newSeenPaths() *seenPaths {
+	workingDir, _ := os.Getwd()
+	return &seenPaths{workingDir: workingDir, paths: make(map[string]null)}
+}
+
+// filter returns results not seen before, reusing data
+func (s *seenPaths) filter(data []Result) []Result {
+	kept := data[:0]
+	for _, result := range data {
+		path := result.path()
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(s.workingDir, path)
+		}
+		if _, seen := s.paths[path]; seen {
+			result.dir.release()
+			continue
+		}
+		s.paths[path] = nullv
+		kept = append(kept, result)
+	}
+	return kept
+}
+
+// uniqueResults keeps a single result per file, the one with the shortest path or the first one
+// lexicographically among equally long. Choice doesn't depend on traversal order, so it is reproducible,
+// but it requires holding all results until the scan is complete
+type uniqueResults map[fileID]Result
+
+func (u uniqueResults) add(data []Result) {
+	for _, result := range data {
+		id := fileID{dev: result.dev, ino: result.ino}
+		current, seen := u[id]
+		if !seen || isPreferredPath(result.name, current.name) {
+			u[id] = result
+		}
+	}
+}
+
+// flush passes kept results to handle in batches of batchSize
+func (u uniqueResults) flush(batchSize int, handle func(data []Result)) {
+	batch := make([]Result, 0, batchSize)
+	for _, result := range u {
+		batch = append(batch, result)
+		if len(batch) == batchSize {
+			handle(batch)
+			batch = make([]Result, 0, batchSize)
+		}
+	}
+	if len(batch) != 0 {
+		handle(batch)
+	}
+}
+
+func isPreferredPath(candidate, current string) bool {
+	if len(candidate) != len(current) {
+		return len(candidate) < len(current)
+	}
+	return candidate < current
+}
@@ -2,11 +2,17 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"os"
 	"os/signal"
 	"os/user"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
 )
 
 func IsDir(filename string) error {
@@ -58,3 +64,320 @@ func quitOnInterrupt() chan bool {
 	}()
 	return quit
 }
+
+func ParseInodeRange(value string) (inodeRange, error) {
+	from, to, found := strings.Cut(value, "-")
+	if !found {
+		return inodeRange{}, errors.New(value + ": inode range must be in form A-B")
+	}
+	start, err := strconv.ParseUint(strings.TrimSpace(from), 10, 64)
+	if err != nil {
+		return inodeRange{}, errors.New(value + ": invalid range start")
+	}
+	end, err := strconv.ParseUint(strings.TrimSpace(to), 10, 64)
+	if err != nil {
+		return inodeRange{}, errors.New(value + ": invalid range end")
+	}
+	if start > end {
+		return inodeRange{}, errors.New(value + ": range start is greater than its end")
+	}
+	return inodeRange{from: start, to: end}, nil
+}
+
+// ParseMode parses octal permission bits, like 0644 or 755
+func ParseMode(value string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode > 07777 {
+		return 0, errors.New(value + ": mode must be octal number up to 7777")
+	}
+	return os.FileMode(mode), nil
+}
+
+// ParseOwner parses user:group into numeric ids, either part might be a name, an id or omitted (-1)
+func ParseOwner(value string) (uid, gid int, err error) {
+	userName, groupName, _ := strings.Cut(value, ":")
+	uid, gid = -1, -1
+	if userName != "" {
+		if uid, err = strconv.Atoi(userName); err != nil {
+			u, lookupErr := user.Lookup(userName)
+			if lookupErr != nil {
+				return 0, 0, lookupErr
+			}
+			uid, _ = strconv.Atoi(u.Uid)
+		}
+	}
+	if groupName != "" {
+		if gid, err = strconv.Atoi(groupName); err != nil {
+			g, lookupErr := user.LookupGroup(groupName)
+			if lookupErr != nil {
+				return 0, 0, lookupErr
+			}
+			gid, _ = strconv.Atoi(g.Gid)
+		}
+	}
+	if uid == -1 && gid == -1 {
+		return 0, 0, errors.New(value + ": either user or group must be specified")
+	}
+	return uid, gid, nil
+}
+
+const openDirFlags = unix.O_RDONLY | unix.O_DIRECTORY | unix.O_CLOEXEC
+
+// OpenAt opens directory name relative to open directory dir, path is its full path used as name of the file
+func OpenAt(dir *os.File, name, path string) (*os.File, error) {
+	fd, err := unix.Openat(int(dir.Fd()), name, openDirFlags, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "openat", Path: path, Err: err}
+	}
+	return os.NewFile(uintptr(fd), path), nil
+}
+
+// OpenLongPath opens directory which path exceeds PATH_MAX, by descending into it one component at a time
+func OpenLongPath(path string) (*os.File, error) {
+	fd := unix.AT_FDCWD
+	if filepath.IsAbs(path) {
+		var err error
+		if fd, err = unix.Open("/", openDirFlags, 0); err != nil {
+			return nil, err
+		}
+	}
+	for _, component := range strings.Split(path, string(os.PathSeparator)) {
+		if component == "" {
+			continue
+		}
+		next, err := unix.Openat(fd, component, openDirFlags, 0)
+		if fd != unix.AT_FDCWD {
+			unix.Close(fd)
+		}
+		if err != nil {
+			return nil, &os.PathError{Op: "open", Path: path, Err: err}
+		}
+		fd = next
+	}
+	if fd == unix.AT_FDCWD {
+		return os.Open(".")
+	}
+	return os.NewFile(uintptr(fd), path), nil
+}
+
+// ByteSize is a size flag accepting optional binary suffix: K, M, G, T (e.g., 512K, 10G)
+type ByteSize int64
+
+func (b *ByteSize) UnmarshalFlag(value string) error {
+	multiplier := int64(1)
+	number := strings.TrimSuffix(strings.ToUpper(value), "B")
+	if number != "" {
+		switch number[len(number)-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		case 'T':
+			multiplier = 1 << 40
+		}
+		if multiplier != 1 {
+			number = number[:len(number)-1]
+		}
+	}
+	size, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || size < 0 {
+		return errors.New(value + ": size must be a non negative number with optional K, M, G or T suffix")
+	}
+	*b = ByteSize(size * multiplier)
+	return nil
+}
+
+// String renders size with the largest suffix dividing it evenly, so it can be parsed back by UnmarshalFlag
+func (b ByteSize) String() string {
+	for _, unit := range []struct {
+		suffix string
+		size   ByteSize
+	}{{"T", 1 << 40}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}} {
+		if b >= unit.size && b%unit.size == 0 {
+			return strconv.FormatInt(int64(b/unit.size), 10) + unit.suffix
+		}
+	}
+	return strconv.FormatInt(int64(b), 10)
+}
+
+// ParseSizeBuckets parses comma separated ascending sizes (e.g., 4K,1M,1G) into histogram bounds
+func ParseSizeBuckets(value string) ([]int64, error) {
+	var bounds []int64
+	for _, item := range strings.Split(value, ",") {
+		var size ByteSize
+		if err := size.UnmarshalFlag(strings.TrimSpace(item)); err != nil {
+			return nil, err
+		}
+		if len(bounds) != 0 && int64(size) <= bounds[len(bounds)-1] {
+			return nil, fmt.Errorf("%s: buckets must be in ascending order", value)
+		}
+		bounds = append(bounds, int64(size))
+	}
+	return bounds, nil
+}
+
+// ParseAge parses duration allowing additional "d" suffix for days (e.g., 30d)
+func ParseAge(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.ParseInt(days, 10, 64)
+		if err != nil || n < 0 {
+			return 0, errors.New(value + ": age must be a non negative number of days or a duration (e.g., 30d, 12h)")
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	age, err := time.ParseDuration(value)
+	if err != nil || age < 0 {
+		return 0, errors.New(value + ": age must be a non negative number of days or a duration (e.g., 30d, 12h)")
+	}
+	return age, nil
+}
+
+// FormatAge is reverse of ParseAge, using days when duration is whole number of them
+func FormatAge(age time.Duration) string {
+	day := 24 * time.Hour
+	if age >= day && age%day == 0 {
+		return strconv.FormatInt(int64(age/day), 10) + "d"
+	}
+	return age.String()
+}
+
+// direntTypeNames maps --type values of single types to dirent types
+var direntTypeNames = map[string]uint8{
+	"file":    syscall.DT_REG,
+	"dir":     syscall.DT_DIR,
+	"link":    syscall.DT_LNK,
+	"socket":  syscall.DT_SOCK,
+	"char":    syscall.DT_CHR,
+	"block":   syscall.DT_BLK,
+	"unknown": syscall.DT_UNKNOWN,
+}
+
+// TimeFilter is an age flag of time filters, either for entries of all types or qualified by type as type:age
+// (e.g., 30d, file:30d, dir:365d). It can be specified multiple times, qualified values override the unqualified one
+type TimeFilter struct {
+	Age     time.Duration
+	PerType map[uint8]time.Duration
+}
+
+func (f *TimeFilter) UnmarshalFlag(value string) error {
+	name, age, qualified := strings.Cut(value, ":")
+	if !qualified {
+		parsed, err := ParseAge(value)
+		f.Age = parsed
+		return err
+	}
+	direntType, ok := direntTypeNames[name]
+	if !ok {
+		return fmt.Errorf("%s: unknown type %q, possible values: file, dir, link, socket, char, block, unknown", value, name)
+	}
+	parsed, err := ParseAge(age)
+	if err != nil {
+		return err
+	}
+	if f.PerType == nil {
+		f.PerType = make(map[uint8]time.Duration)
+	}
+	f.PerType[direntType] = parsed
+	return nil
+}
+
+// For returns age of filter for entries of dirent type, zero if it doesn't apply to them
+func (f TimeFilter) For(direntType uint8) time.Duration {
+	if age, ok := f.PerType[direntType]; ok {
+		return age
+	}
+	return f.Age
+}
+
+// Excludes tells whether filter rejects entries of dirent type altogether, as it is qualified by other types only.
+// So --mtime-older file:30d alone matches old files, rather than old files and everything else
+func (f TimeFilter) Excludes(direntType uint8) bool {
+	_, ok := f.PerType[direntType]
+	return f.Age == 0 && len(f.PerType) != 0 && !ok
+}
+
+// IsSet tells whether filter applies to entries of any type
+func (f TimeFilter) IsSet() bool {
+	return f.Age != 0 || len(f.PerType) != 0
+}
+
+// ParseAgeBuckets parses comma separated ascending ages (e.g., 1d,7d,30d) into histogram bounds
+func ParseAgeBuckets(value string) ([]int64, error) {
+	var bounds []int64
+	for _, item := range strings.Split(value, ",") {
+		age, err := ParseAge(strings.TrimSpace(item))
+		if err != nil {
+			return nil, err
+		}
+		if len(bounds) != 0 && int64(age) <= bounds[len(bounds)-1] {
+			return nil, fmt.Errorf("%s: buckets must be in ascending order", value)
+		}
+		bounds = append(bounds, int64(age))
+	}
+	return bounds, nil
+}
+
+// RaiseOpenFilesLimit raises soft RLIMIT_NOFILE toward the hard limit, until it reaches needed.
+// Go runtime already raises it to the hard limit on startup, this covers environments where it didn't happen
+func RaiseOpenFilesLimit(needed uint64) (before, after uint64, err error) {
+	var limit unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_NOFILE, &limit); err != nil {
+		return 0, 0, err
+	}
+	before = uint64(limit.Cur)
+	if before >= needed {
+		return before, before, nil
+	}
+	after = min(needed, uint64(limit.Max))
+	limit.Cur = convertLimit(limit.Cur, after)
+	if err := unix.Setrlimit(unix.RLIMIT_NOFILE, &limit); err != nil {
+		return before, before, err
+	}
+	return before, after, nil
+}
+
+// convertLimit converts value to type of rlimit field, which is signed on some platforms
+func convertLimit[T int64 | uint64](_ T, value uint64) T {
+	return T(value)
+}
+
+// FormatMode renders type and permission bits of mode like ls -l does (e.g., -rwxr-xr-x, drwxrwxrwt)
+func FormatMode(mode os.FileMode) string {
+	buf := []byte("----------")
+	switch {
+	case mode&os.ModeDir != 0:
+		buf[0] = 'd'
+	case mode&os.ModeSymlink != 0:
+		buf[0] = 'l'
+	case mode&os.ModeNamedPipe != 0:
+		buf[0] = 'p'
+	case mode&os.ModeSocket != 0:
+		buf[0] = 's'
+	case mode&os.ModeCharDevice != 0:
+		buf[0] = 'c'
+	case mode&os.ModeDevice != 0:
+		buf[0] = 'b'
+	}
+	const rwx = "rwxrwxrwx"
+	for i := range rwx {
+		if mode&(1<<uint(8-i)) != 0 {
+			buf[i+1] = rwx[i]
+		}
+	}
+	special := func(set bool, i int, lower, upper byte) {
+		if !set {
+			return
+		}
+		if buf[i] == 'x' {
+			buf[i] = lower
+		} else {
+			buf[i] = upper
+		}
+	}
+	special(mode&os.ModeSetuid != 0, 3, 's', 'S')
+	special(mode&os.ModeSetgid != 0, 6, 's', 'S')
+	special(mode&os.ModeSticky != 0, 9, 't', 'T')
+	return string(buf)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestTimeFilterFor(t *testing.T) {
+	var filter TimeFilter
+	for _, value := range []string{"file:30d", "dir:1h"} {
+		if err := filter.UnmarshalFlag(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if age := filter.For(syscall.DT_REG); age != 30*24*time.Hour {
+		t.Errorf("expected 30d for files, got %s", age)
+	}
+	if age := filter.For(syscall.DT_DIR); age != time.Hour {
+		t.Errorf("expected 1h for directories, got %s", age)
+	}
+	if filter.Excludes(syscall.DT_REG) || filter.Excludes(syscall.DT_DIR) || !filter.Excludes(syscall.DT_LNK) {
+		t.Errorf("expected only links to be excluded by %v", filter)
+	}
+	if err := filter.UnmarshalFlag("2d"); err != nil {
+		t.Fatal(err)
+	}
+	if age := filter.For(syscall.DT_LNK); age != 48*time.Hour || filter.Excludes(syscall.DT_LNK) {
+		t.Errorf("expected unqualified 2d for links, got %s", age)
+	}
+}